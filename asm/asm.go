@@ -0,0 +1,284 @@
+// Package asm assembles Chip-8 programs from the mnemonics that the disassembler outputs.
+//
+// Every line holds an optional label, an instruction or directive and an optional comment:
+//
+//	loop:   LD   V0, 0a      ; numbers are hexadecimal, like in the disassembly
+//	        JP   loop
+//	speed   EQU  0x10        ; constants, also 0x.. for hexadecimal and %.. for binary numbers
+//	sprite: db   %11110000, f0
+//	        dw   1234
+//	        include "font.asm"
+//
+// The address and opcode columns that prefix the output of the disassembler are ignored,
+// so that disassembled programs assemble to the same binary.
+package asm
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/arjenvanderende/chip8/chip8"
+	"github.com/arjenvanderende/chip8/sourcemap"
+)
+
+// origin represents the address at which programs are loaded
+const origin = 0x200
+
+var (
+	disassemblyPrefix = regexp.MustCompile(`^\s*([0-9a-fA-F]{4}) ([0-9a-fA-F]{2}) ([0-9a-fA-F]{2})\s+`)
+	labelPattern      = regexp.MustCompile(`^\s*([A-Za-z_][A-Za-z0-9_.]*):`)
+	namePattern       = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.]*$`)
+)
+
+// Program represents an assembled program
+type Program struct {
+	Code    []byte
+	Sources *sourcemap.Map
+}
+
+// statement represents an instruction or data directive at an address
+type statement struct {
+	file     string
+	line     int
+	addr     int
+	mnemonic string
+	operands []string
+	raw      []byte // the opcode of the disassembly prefix
+}
+
+// symbol represents a label or a constant
+type symbol struct {
+	expr  string // the expression of a constant
+	value int
+	label bool
+}
+
+type assembler struct {
+	statements []statement
+	symbols    map[string]*symbol
+	addr       int
+	including  []string
+}
+
+// AssembleFile assembles the source file and the files that it includes
+func AssembleFile(filename string) (*Program, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read source file: %v", err)
+	}
+	return Assemble(filename, data)
+}
+
+// Assemble assembles the source, includes are resolved relative to the file name
+func Assemble(filename string, source []byte) (*Program, error) {
+	a := &assembler{symbols: make(map[string]*symbol), addr: origin}
+	if err := a.parse(filename, source); err != nil {
+		return nil, err
+	}
+
+	program := &Program{Sources: &sourcemap.Map{Symbols: make(map[string]int)}}
+	for _, s := range a.statements {
+		code, err := a.encode(s)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", s.file, s.line, err)
+		}
+		program.Code = append(program.Code, code...)
+		program.Sources.Add(s.addr, s.file, s.line)
+	}
+	for name, sym := range a.symbols {
+		if sym.label {
+			program.Sources.Symbols[name] = sym.value
+		}
+	}
+	if len(program.Code) > chip8.MaxProgramSize {
+		return nil, fmt.Errorf("Program of %d bytes does not fit in memory of %d bytes", len(program.Code), chip8.MaxProgramSize)
+	}
+	return program, nil
+}
+
+// parse collects the statements and symbols of the source, determining the address of every statement
+func (a *assembler) parse(filename string, source []byte) error {
+	for _, f := range a.including {
+		if f == filename {
+			return fmt.Errorf("%s includes itself", filename)
+		}
+	}
+	a.including = append(a.including, filename)
+	defer func() { a.including = a.including[:len(a.including)-1] }()
+
+	scanner := bufio.NewScanner(bytes.NewReader(source))
+	for n := 1; scanner.Scan(); n++ {
+		if err := a.parseLine(filename, n, scanner.Text()); err != nil {
+			return fmt.Errorf("%s:%d: %v", filename, n, err)
+		}
+	}
+	return scanner.Err()
+}
+
+func (a *assembler) parseLine(filename string, n int, text string) error {
+	if i := strings.IndexByte(text, ';'); i >= 0 {
+		text = text[:i]
+	}
+	s := statement{file: filename, line: n, addr: a.addr}
+	if m := disassemblyPrefix.FindStringSubmatch(text); m != nil {
+		hi, _ := strconv.ParseUint(m[2], 16, 8)
+		lo, _ := strconv.ParseUint(m[3], 16, 8)
+		s.raw = []byte{byte(hi), byte(lo)}
+		text = text[len(m[0]):]
+	}
+	if m := labelPattern.FindStringSubmatch(text); m != nil {
+		if err := a.define(m[1], &symbol{value: a.addr, label: true}); err != nil {
+			return err
+		}
+		text = text[len(m[0]):]
+	}
+
+	fields := strings.Fields(text)
+	if len(fields) == 0 {
+		return nil
+	}
+
+	// constants
+	if len(fields) >= 3 && strings.EqualFold(fields[1], "EQU") {
+		if !namePattern.MatchString(fields[0]) {
+			return fmt.Errorf("Invalid constant name %s", fields[0])
+		}
+		return a.define(fields[0], &symbol{expr: strings.Join(fields[2:], " ")})
+	}
+
+	s.mnemonic = strings.ToUpper(fields[0])
+	rest := strings.TrimSpace(text)[len(fields[0]):]
+	if strings.TrimSpace(rest) != "" {
+		for _, operand := range strings.Split(rest, ",") {
+			s.operands = append(s.operands, strings.TrimSpace(operand))
+		}
+	}
+
+	switch s.mnemonic {
+	case "INCLUDE":
+		if len(s.operands) != 1 {
+			return fmt.Errorf("Expected the file to include")
+		}
+		name := strings.Trim(s.operands[0], `"`)
+		if !filepath.IsAbs(name) {
+			name = filepath.Join(filepath.Dir(filename), name)
+		}
+		data, err := ioutil.ReadFile(name)
+		if err != nil {
+			return fmt.Errorf("Unable to include file: %v", err)
+		}
+		return a.parse(name, data)
+	case "DB":
+		a.addr += len(s.operands)
+	case "DW":
+		a.addr += 2 * len(s.operands)
+	default:
+		a.addr += 2
+		if s.mnemonic == "LD" && len(s.operands) == 2 && isLong(s.operands[1]) {
+			a.addr += 2
+		}
+	}
+	a.statements = append(a.statements, s)
+	return nil
+}
+
+func (a *assembler) define(name string, sym *symbol) error {
+	if _, ok := a.symbols[name]; ok {
+		return fmt.Errorf("Symbol %s is already defined", name)
+	}
+	if _, ok := register(name); ok {
+		return fmt.Errorf("Symbol %s is a register", name)
+	}
+	if _, ok := keywords[strings.ToUpper(name)]; ok {
+		return fmt.Errorf("Symbol %s is a reserved word", name)
+	}
+	a.symbols[name] = sym
+	return nil
+}
+
+// eval returns the value of an expression of numbers and symbols, added and subtracted
+func (a *assembler) eval(expr string) (int, error) {
+	return a.evalSymbols(expr, nil)
+}
+
+func (a *assembler) evalSymbols(expr string, resolving []string) (int, error) {
+	expr = strings.TrimSpace(expr)
+	if expr == "" {
+		return 0, fmt.Errorf("Missing value")
+	}
+
+	// split the expression into terms, keeping a leading sign as part of the first term
+	total, sign, start := 0, 1, 0
+	for i := 0; i <= len(expr); i++ {
+		if i < len(expr) && (expr[i] != '+' && expr[i] != '-' || i == start) {
+			continue
+		}
+		term := strings.TrimSpace(expr[start:i])
+		termSign := sign
+		if strings.HasPrefix(term, "-") {
+			termSign, term = -termSign, strings.TrimSpace(term[1:])
+		}
+		value, err := a.term(term, resolving)
+		if err != nil {
+			return 0, err
+		}
+		total += termSign * value
+		if i < len(expr) {
+			sign = 1
+			if expr[i] == '-' {
+				sign = -1
+			}
+		}
+		start = i + 1
+	}
+	return total, nil
+}
+
+func (a *assembler) term(term string, resolving []string) (int, error) {
+	if sym, ok := a.symbols[term]; ok {
+		if sym.label {
+			return sym.value, nil
+		}
+		for _, name := range resolving {
+			if name == term {
+				return 0, fmt.Errorf("Constant %s is defined in terms of itself", term)
+			}
+		}
+		return a.evalSymbols(sym.expr, append(resolving, term))
+	}
+
+	lower := strings.ToLower(term)
+	base, digits := 16, lower
+	switch {
+	case strings.HasPrefix(lower, "0x"):
+		digits = lower[2:]
+	case strings.HasPrefix(lower, "%"):
+		base, digits = 2, lower[1:]
+	}
+	value, err := strconv.ParseUint(digits, base, 32)
+	if err != nil {
+		return 0, fmt.Errorf("Unknown symbol or invalid number %s", term)
+	}
+	return int(value), nil
+}
+
+// isLong reports whether the operand is the 16-bit address of LD I, LONG nnnn
+func isLong(operand string) bool {
+	fields := strings.Fields(operand)
+	return len(fields) > 1 && strings.EqualFold(fields[0], "LONG")
+}
+
+// register returns the index of the register Vx
+func register(operand string) (byte, bool) {
+	if len(operand) != 2 || operand[0] != 'V' && operand[0] != 'v' {
+		return 0, false
+	}
+	x, err := strconv.ParseUint(operand[1:], 16, 4)
+	return byte(x), err == nil
+}
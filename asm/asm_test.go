@@ -0,0 +1,38 @@
+package asm_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/arjenvanderende/chip8/asm"
+	"github.com/arjenvanderende/chip8/chip8"
+)
+
+// TestAssembleInstructions checks that the mnemonic of every instruction assembles to its opcode
+func TestAssembleInstructions(t *testing.T) {
+	opcodes := []uint16{
+		0x0123, 0x00e0, 0x00ee, 0x00c5, 0x00d7, 0x00fb, 0x00fc, 0x00fd, 0x00fe, 0x00ff,
+		0x1234, 0x2abc, 0x31ff, 0x4e07, 0x5120, 0x5342, 0x5ab3, 0x6c12, 0x7d34,
+		0x8120, 0x8121, 0x8122, 0x8123, 0x8124, 0x8125, 0x8126, 0x8127, 0x812e, 0x9ef0,
+		0xa456, 0xb789, 0xc3aa, 0xd125, 0xd120, 0xe59e, 0xe6a1,
+		0xf201, 0xf002, 0xf107, 0xf20a, 0xf315, 0xf418, 0xf51e, 0xf629, 0xf730,
+		0xf833, 0xf93a, 0xfa55, 0xfb65, 0xf375, 0xf385,
+	}
+	for _, op := range opcodes {
+		in := chip8.Decode(op)
+		if in.Kind == chip8.OpUnknown {
+			t.Errorf("Decode(%04x) is unknown", op)
+			continue
+		}
+		source := in.String()
+		program, err := asm.Assemble("test.asm", []byte(source))
+		if err != nil {
+			t.Errorf("Assemble(%q) of %04x: %v", source, op, err)
+			continue
+		}
+		expected := []byte{byte(op >> 8), byte(op)}
+		if !bytes.Equal(program.Code, expected) {
+			t.Errorf("Assemble(%q) = % x, expected % x", source, program.Code, expected)
+		}
+	}
+}
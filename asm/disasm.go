@@ -0,0 +1,202 @@
+package asm
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/arjenvanderende/chip8/chip8"
+)
+
+// bytesPerLine represents the maximum number of data bytes per db directive
+const bytesPerLine = 8
+
+// disassembler separates the code of a program from its data by following the control flow
+type disassembler struct {
+	code   []byte
+	starts map[int]chip8.Instruction // instructions by address
+	owner  []int                     // address of the instruction that each byte belongs to, or -1 for data
+	labels map[int]string
+}
+
+// Disassemble writes the assembly of the program, which is loaded at 0x200, to w.
+// Instructions are found by following jumps, calls and skips from the entry point,
+// all other bytes are output as data. Assembling the output produces the same program.
+func Disassemble(w io.Writer, code []byte) error {
+	d := &disassembler{
+		code:   code,
+		starts: make(map[int]chip8.Instruction),
+		owner:  make([]int, len(code)),
+		labels: make(map[int]string),
+	}
+	for i := range d.owner {
+		d.owner[i] = -1
+	}
+	d.trace(origin)
+	return d.write(w)
+}
+
+// contains reports whether the address lies within the program
+func (d *disassembler) contains(addr int) bool {
+	return addr >= origin && addr < origin+len(d.code)
+}
+
+// decode returns the instruction at the address, if it lies completely within the program
+func (d *disassembler) decode(addr int) (chip8.Instruction, bool) {
+	if !d.contains(addr) || !d.contains(addr+1) {
+		return chip8.Instruction{}, false
+	}
+	in := chip8.Decode(uint16(d.code[addr-origin])<<8 | uint16(d.code[addr-origin+1]))
+	if in.Kind == chip8.OpLDILong {
+		if !d.contains(addr + 3) {
+			return chip8.Instruction{}, false
+		}
+		in.NNNN = uint16(d.code[addr-origin+2])<<8 | uint16(d.code[addr-origin+3])
+	}
+	return in, in.Kind != chip8.OpUnknown
+}
+
+// trace marks the instructions that are reachable from the address
+func (d *disassembler) trace(entry int) {
+	pending := []int{entry}
+	for len(pending) > 0 {
+		addr := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+
+		for {
+			if _, ok := d.starts[addr]; ok {
+				break
+			}
+			in, ok := d.decode(addr)
+			if !ok || !d.claim(addr, in.Size()) {
+				break
+			}
+			d.starts[addr] = in
+			next := addr + in.Size()
+
+			switch in.Kind {
+			case chip8.OpJP:
+				d.label(int(in.NNN), "code")
+				pending = append(pending, int(in.NNN))
+			case chip8.OpCALL:
+				d.label(int(in.NNN), "sub")
+				pending = append(pending, int(in.NNN))
+			case chip8.OpJPV0:
+				// the target depends on V0, so only the base of the jump table is known
+				d.label(int(in.NNN), "table")
+			case chip8.OpLDI:
+				d.label(int(in.NNN), "data")
+			case chip8.OpLDILong:
+				d.label(int(in.NNNN), "data")
+			case chip8.OpSEByte, chip8.OpSNEByte, chip8.OpSEReg, chip8.OpSNEReg, chip8.OpSKP, chip8.OpSKNP:
+				// the skipped instruction may be 4 bytes long
+				if skipped, ok := d.decode(next); ok {
+					pending = append(pending, next+skipped.Size())
+				}
+			}
+			if in.Kind == chip8.OpJP || in.Kind == chip8.OpJPV0 || in.Kind == chip8.OpRET || in.Kind == chip8.OpEXIT {
+				break
+			}
+			addr = next
+		}
+	}
+}
+
+// claim marks the bytes of an instruction as code, unless they already belong to another instruction
+func (d *disassembler) claim(addr, size int) bool {
+	for a := addr; a < addr+size; a++ {
+		if d.owner[a-origin] >= 0 {
+			return false
+		}
+	}
+	for a := addr; a < addr+size; a++ {
+		d.owner[a-origin] = addr
+	}
+	return true
+}
+
+// label names the address when it lies within the program, calls take precedence over other names
+func (d *disassembler) label(addr int, kind string) {
+	if !d.contains(addr) {
+		return
+	}
+	if name, ok := d.labels[addr]; ok && (strings.HasPrefix(name, "sub_") || kind != "sub") {
+		return
+	}
+	d.labels[addr] = fmt.Sprintf("%s_%03x", kind, addr)
+}
+
+// target returns the label of the address, or the address itself when it can not be labelled
+func (d *disassembler) target(addr int, digits int) string {
+	if name, ok := d.labels[addr]; ok && d.boundary(addr) {
+		return name
+	}
+	return fmt.Sprintf("%0*x", digits, addr)
+}
+
+// boundary reports whether a statement starts at the address, so that a label can be placed there
+func (d *disassembler) boundary(addr int) bool {
+	owner := d.owner[addr-origin]
+	return owner < 0 || owner == addr
+}
+
+func (d *disassembler) write(w io.Writer) error {
+	var data []string
+	flush := func() error {
+		if len(data) == 0 {
+			return nil
+		}
+		_, err := fmt.Fprintf(w, "        %-10s %s\n", "db", strings.Join(data, ", "))
+		data = data[:0]
+		return err
+	}
+
+	for addr := origin; addr < origin+len(d.code); {
+		if name, ok := d.labels[addr]; ok && d.boundary(addr) {
+			if err := flush(); err != nil {
+				return err
+			}
+			if _, err := fmt.Fprintf(w, "%s:\n", name); err != nil {
+				return err
+			}
+		}
+
+		in, ok := d.starts[addr]
+		if !ok {
+			data = append(data, fmt.Sprintf("%02x", d.code[addr-origin]))
+			if len(data) == bytesPerLine {
+				if err := flush(); err != nil {
+					return err
+				}
+			}
+			addr++
+			continue
+		}
+
+		if err := flush(); err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(w, "        %s\n", strings.TrimSpace(d.format(in))); err != nil {
+			return err
+		}
+		addr += in.Size()
+	}
+	return flush()
+}
+
+// format outputs the assembly of the instruction, with labels for its target address
+func (d *disassembler) format(in chip8.Instruction) string {
+	switch in.Kind {
+	case chip8.OpJP:
+		return fmt.Sprintf("%-10s %s", "JP", d.target(int(in.NNN), 3))
+	case chip8.OpCALL:
+		return fmt.Sprintf("%-10s %s", "CALL", d.target(int(in.NNN), 3))
+	case chip8.OpJPV0:
+		return fmt.Sprintf("%-10s V0, %s", "JP", d.target(int(in.NNN), 3))
+	case chip8.OpLDI:
+		return fmt.Sprintf("%-10s I, %s", "LD", d.target(int(in.NNN), 3))
+	case chip8.OpLDILong:
+		return fmt.Sprintf("%-10s I, LONG %s", "LD", d.target(int(in.NNNN), 4))
+	}
+	return in.String()
+}
@@ -0,0 +1,61 @@
+package asm_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/arjenvanderende/chip8/asm"
+)
+
+func TestDisassembleRoundTrip(t *testing.T) {
+	programs := map[string][]byte{
+		"empty": {},
+		"loop": {
+			0x60, 0x05, // 200: LD V0, 05
+			0xa2, 0x0a, // 202: LD I, 20A
+			0xd0, 0x15, // 204: DRW V0, V1, 5
+			0x70, 0x01, // 206: ADD V0, 01
+			0x12, 0x04, // 208: JP 204
+			0xf0, 0x90, 0x90, 0x90, 0xf0,
+		},
+		"subroutine": {
+			0x22, 0x06, // 200: CALL 206
+			0x00, 0xfd, // 202: EXIT
+			0x51, 0x21, // 204: data that is not an instruction
+			0x30, 0x00, // 206: SE V0, 00
+			0x00, 0xee, // 208: RET
+			0x13, 0x00, // 20A: JP 300, outside of the program
+		},
+		"long": {
+			0xf0, 0x00, 0x02, 0x08, // 200: LD I, LONG 0208
+			0xb2, 0x06, // 204: JP V0, 206
+			0x12, 0x06, // 206: JP 206
+			0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x09, 0x0a,
+		},
+		"odd data": {
+			0x12, 0x03, // 200: JP 203
+			0xaa,
+			0x00, 0xe0, // 203: CLS
+			0x12, 0x03, // 205: JP 203
+		},
+		"truncated": {
+			0x60, 0x01, // 200: LD V0, 01
+			0xf0,
+		},
+	}
+	for name, code := range programs {
+		var source bytes.Buffer
+		if err := asm.Disassemble(&source, code); err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		program, err := asm.Assemble("test.asm", source.Bytes())
+		if err != nil {
+			t.Errorf("%s: Assemble() of the disassembly: %v\n%s", name, err, source.String())
+			continue
+		}
+		if !bytes.Equal(program.Code, code) {
+			t.Errorf("%s: Assemble() of the disassembly = % x, expected % x\n%s", name, program.Code, code, source.String())
+		}
+	}
+}
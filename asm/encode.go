@@ -0,0 +1,251 @@
+package asm
+
+import (
+	"fmt"
+	"strings"
+)
+
+// keywords are the operands, besides registers and values, that select the form of an instruction
+var keywords = map[string]string{
+	"I":     "I",
+	"[I]":   "[I]",
+	"DELAY": "DT",
+	"DT":    "DT",
+	"SOUND": "ST",
+	"ST":    "ST",
+	"KEY":   "K",
+	"K":     "K",
+	"F":     "F",
+	"HF":    "HF",
+	"B":     "B",
+	"R":     "R",
+}
+
+// encode returns the bytes of the statement
+func (a *assembler) encode(s statement) ([]byte, error) {
+	switch s.mnemonic {
+	case "DB":
+		return a.data(s.operands, 1, 0xff)
+	case "DW":
+		return a.data(s.operands, 2, 0xffff)
+	case "UNKNOWN":
+		// data that was disassembled, the opcode is only known from the prefix
+		if s.raw == nil {
+			return nil, fmt.Errorf("Unknown instruction, use db or dw for data")
+		}
+		return s.raw, nil
+	}
+
+	op, long, err := a.opcode(s.mnemonic, s.operands)
+	if err != nil {
+		return nil, err
+	}
+	if s.mnemonic == "LD" && len(s.operands) == 2 && isLong(s.operands[1]) {
+		return []byte{byte(op >> 8), byte(op), byte(long >> 8), byte(long)}, nil
+	}
+	return []byte{byte(op >> 8), byte(op)}, nil
+}
+
+// data returns the values of the operands of a db or dw directive
+func (a *assembler) data(operands []string, size, max int) ([]byte, error) {
+	var code []byte
+	for _, operand := range operands {
+		value, err := a.value(operand, max)
+		if err != nil {
+			return nil, err
+		}
+		if size == 2 {
+			code = append(code, byte(value>>8))
+		}
+		code = append(code, byte(value))
+	}
+	return code, nil
+}
+
+// value evaluates the operand and checks that it fits in the range up to max.
+// Negative values are stored in two's complement.
+func (a *assembler) value(operand string, max int) (int, error) {
+	value, err := a.eval(operand)
+	if err != nil {
+		return 0, err
+	}
+	if value < -(max+1)/2 || value > max {
+		return 0, fmt.Errorf("Value %s is out of range 0-%x", operand, max)
+	}
+	return value & max, nil
+}
+
+// opcode returns the opcode of the instruction, and the address of LD I, LONG nnnn
+func (a *assembler) opcode(mnemonic string, operands []string) (uint16, uint16, error) {
+	form := make([]string, len(operands))
+	regs := make([]uint16, len(operands))
+	for i, operand := range operands {
+		if x, ok := register(operand); ok {
+			form[i], regs[i] = "V", uint16(x)
+		} else if keyword, ok := keywords[strings.ToUpper(operand)]; ok && !isDigit(mnemonic, i, keyword) {
+			form[i] = keyword
+		} else if isLong(operand) {
+			form[i] = "LONG"
+		} else {
+			form[i] = "n"
+		}
+	}
+	signature := mnemonic
+	if len(form) > 0 {
+		signature += " " + strings.Join(form, ",")
+	}
+
+	// x and y return the register of the operand at the index, shifted into place
+	x := func(i int) uint16 { return regs[i] << 8 }
+	y := func(i int) uint16 { return regs[i] << 4 }
+	// n returns the value of the operand at the index
+	var err error
+	n := func(i int, max int) uint16 {
+		value, e := a.value(operands[i], max)
+		if e != nil && err == nil {
+			err = e
+		}
+		return uint16(value)
+	}
+
+	var op, long uint16
+	switch signature {
+	case "CLS":
+		op = 0x00e0
+	case "RET":
+		op = 0x00ee
+	case "SCR":
+		op = 0x00fb
+	case "SCL":
+		op = 0x00fc
+	case "EXIT":
+		op = 0x00fd
+	case "LOW":
+		op = 0x00fe
+	case "HIGH":
+		op = 0x00ff
+	case "AUDIO":
+		op = 0xf002
+	case "SCD n":
+		op = 0x00c0 | n(0, 0xf)
+	case "SCU n":
+		op = 0x00d0 | n(0, 0xf)
+	case "SYS n":
+		op = 0x0000 | n(0, 0xfff)
+	case "JP n":
+		op = 0x1000 | n(0, 0xfff)
+	case "CALL n":
+		op = 0x2000 | n(0, 0xfff)
+	case "SE V,n":
+		op = 0x3000 | x(0) | n(1, 0xff)
+	case "SNE V,n":
+		op = 0x4000 | x(0) | n(1, 0xff)
+	case "SE V,V":
+		op = 0x5000 | x(0) | y(1)
+	case "SAVE V,V":
+		op = 0x5002 | x(0) | y(1)
+	case "LOAD V,V":
+		op = 0x5003 | x(0) | y(1)
+	case "LD V,n":
+		op = 0x6000 | x(0) | n(1, 0xff)
+	case "ADD V,n":
+		op = 0x7000 | x(0) | n(1, 0xff)
+	case "LD V,V":
+		op = 0x8000 | x(0) | y(1)
+	case "OR V,V":
+		op = 0x8001 | x(0) | y(1)
+	case "AND V,V":
+		op = 0x8002 | x(0) | y(1)
+	case "XOR V,V":
+		op = 0x8003 | x(0) | y(1)
+	case "ADD V,V":
+		op = 0x8004 | x(0) | y(1)
+	case "SUB V,V":
+		op = 0x8005 | x(0) | y(1)
+	case "SUB V,V,V":
+		// the disassembler outputs SUB Vx, Vx, Vy
+		if regs[0] != regs[1] {
+			return 0, 0, fmt.Errorf("SUB stores Vx - Vy in Vx, expected SUB Vx, Vx, Vy")
+		}
+		op = 0x8005 | x(0) | y(2)
+	case "SHR V":
+		op = 0x8006 | x(0) | y(0)
+	case "SHR V,V":
+		op = 0x8006 | x(0) | y(1)
+	case "SUBN V,V":
+		op = 0x8007 | x(0) | y(1)
+	case "SUBN V,V,V":
+		// the disassembler outputs SUBN Vx, Vy, Vy
+		if regs[1] != regs[2] {
+			return 0, 0, fmt.Errorf("SUBN stores Vy - Vx in Vx, expected SUBN Vx, Vy, Vy")
+		}
+		op = 0x8007 | x(0) | y(1)
+	case "SHL V":
+		op = 0x800e | x(0) | y(0)
+	case "SHL V,V":
+		op = 0x800e | x(0) | y(1)
+	case "SNE V,V":
+		op = 0x9000 | x(0) | y(1)
+	case "LD I,n":
+		op = 0xa000 | n(1, 0xfff)
+	case "JP V,n":
+		if regs[0] != 0 {
+			return 0, 0, fmt.Errorf("JP only adds V0 to the address")
+		}
+		op = 0xb000 | n(1, 0xfff)
+	case "RND V,n":
+		op = 0xc000 | x(0) | n(1, 0xff)
+	case "DRW V,V,n":
+		op = 0xd000 | x(0) | y(1) | n(2, 0xf)
+	case "SKP V":
+		op = 0xe09e | x(0)
+	case "SKNP V":
+		op = 0xe0a1 | x(0)
+	case "LD I,LONG":
+		op = 0xf000
+		long, err = a.long(operands[1])
+	case "PLANE n":
+		op = 0xf001 | n(0, 0xf)<<8
+	case "LD V,DT":
+		op = 0xf007 | x(0)
+	case "LD V,K":
+		op = 0xf00a | x(0)
+	case "LD DT,V":
+		op = 0xf015 | x(1)
+	case "LD ST,V":
+		op = 0xf018 | x(1)
+	case "ADD I,V":
+		op = 0xf01e | x(1)
+	case "LD F,V":
+		op = 0xf029 | x(1)
+	case "LD HF,V":
+		op = 0xf030 | x(1)
+	case "LD B,V":
+		op = 0xf033 | x(1)
+	case "PITCH V":
+		op = 0xf03a | x(0)
+	case "LD [I],V":
+		op = 0xf055 | x(1)
+	case "LD V,[I]":
+		op = 0xf065 | x(0)
+	case "LD R,V":
+		op = 0xf075 | x(1)
+	case "LD V,R":
+		op = 0xf085 | x(0)
+	default:
+		return 0, 0, fmt.Errorf("Invalid instruction %s %s", mnemonic, strings.Join(operands, ", "))
+	}
+	return op, long, err
+}
+
+// long returns the 16-bit address of the LONG operand
+func (a *assembler) long(operand string) (uint16, error) {
+	value, err := a.value(strings.TrimSpace(operand)[len("LONG"):], 0xffff)
+	return uint16(value), err
+}
+
+// isDigit reports whether the F or B keyword is a hexadecimal digit instead, since those keywords
+// only occur as the first operand of LD, like LD F, Vx
+func isDigit(mnemonic string, i int, keyword string) bool {
+	return (keyword == "F" || keyword == "B") && (mnemonic != "LD" || i != 0)
+}
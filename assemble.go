@@ -0,0 +1,65 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/arjenvanderende/chip8/asm"
+)
+
+// assemble runs the asm subcommand, which assembles a source file into a ROM file
+func assemble(args []string) error {
+	flags := flag.NewFlagSet("asm", flag.ExitOnError)
+	output := flags.String("o", "", "The ROM file to write, defaults to the source file with the .ch8 extension")
+	sourceMap := flags.Bool("map", false, "Write a source map with the .map extension next to the ROM file, for debugging with -dap")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: chip8 asm [flags] source.asm\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return fmt.Errorf("Expected one source file")
+	}
+
+	source := flags.Arg(0)
+	program, err := asm.AssembleFile(source)
+	if err != nil {
+		return err
+	}
+
+	romfile := *output
+	if romfile == "" {
+		romfile = strings.TrimSuffix(source, filepath.Ext(source)) + ".ch8"
+	}
+	if err := ioutil.WriteFile(romfile, program.Code, 0644); err != nil {
+		return fmt.Errorf("Unable to write ROM file: %v", err)
+	}
+
+	if *sourceMap {
+		mapfile := strings.TrimSuffix(romfile, filepath.Ext(romfile)) + ".map"
+		// refer to the source files relative to the source map, so they can be moved together
+		for i, line := range program.Sources.Lines {
+			if rel, err := relativePath(filepath.Dir(mapfile), line.File); err == nil {
+				program.Sources.Lines[i].File = rel
+			}
+		}
+		return program.Sources.Save(mapfile)
+	}
+	return nil
+}
+
+func relativePath(dir, file string) (string, error) {
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	absFile, err := filepath.Abs(file)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Rel(absDir, absFile)
+}
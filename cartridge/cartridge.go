@@ -0,0 +1,233 @@
+// Package cartridge reads and writes Octo cartridges: GIF images that carry a program and
+// its settings in the lowest two bits of the palette indices of their pixels. The payload
+// consists of a 32-bit big-endian length followed by a JSON object with the Octo source
+// of the program and the options to run it with.
+package cartridge
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"image/gif"
+	goio "io"
+	"io/ioutil"
+
+	"github.com/arjenvanderende/chip8/chip8"
+	"github.com/arjenvanderende/chip8/io"
+)
+
+const (
+	// width and minHeight represent the size of the cartridge image
+	width     = 160
+	minHeight = 128
+	// frameRate represents the number of frames per second, which Octo counts cycles in
+	frameRate = 60
+)
+
+// Options contains the settings of an Octo program
+type Options struct {
+	TickRate        int    `json:"tickrate"` // the number of cycles per frame
+	FillColor       string `json:"fillColor"`
+	FillColor2      string `json:"fillColor2"`
+	BlendColor      string `json:"blendColor"`
+	BackgroundColor string `json:"backgroundColor"`
+	BuzzColor       string `json:"buzzColor"`
+	QuietColor      string `json:"quietColor"`
+	ShiftQuirks     bool   `json:"shiftQuirks"`
+	LoadStoreQuirks bool   `json:"loadStoreQuirks"` // I is left unchanged by Fx55 and Fx65
+	VFOrderQuirks   bool   `json:"vfOrderQuirks"`
+	ClipQuirks      bool   `json:"clipQuirks"`
+	VBlankQuirks    bool   `json:"vBlankQuirks"`
+	JumpQuirks      bool   `json:"jumpQuirks"`
+	LogicQuirks     bool   `json:"logicQuirks"`
+	ScreenRotation  int    `json:"screenRotation"`
+	MaxSize         int    `json:"maxSize"`
+	TouchInputMode  string `json:"touchInputMode"`
+	FontStyle       string `json:"fontStyle"`
+}
+
+// DefaultOptions contains the settings that Octo uses by default
+var DefaultOptions = Options{
+	TickRate:        20,
+	FillColor:       "#FFCC00",
+	FillColor2:      "#FF6600",
+	BlendColor:      "#662200",
+	BackgroundColor: "#996600",
+	BuzzColor:       "#FFAA00",
+	QuietColor:      "#000000",
+	MaxSize:         3584,
+	TouchInputMode:  "none",
+	FontStyle:       "octo",
+}
+
+// Cartridge represents the contents of a cartridge
+type Cartridge struct {
+	Program string  `json:"program"` // the Octo source
+	Options Options `json:"options"`
+}
+
+// Quirks returns the quirks that the options select
+func (o Options) Quirks() chip8.Quirks {
+	return chip8.Quirks{
+		VFReset:  o.LogicQuirks,
+		Memory:   !o.LoadStoreQuirks,
+		Clipping: o.ClipQuirks,
+		Shifting: o.ShiftQuirks,
+		Jumping:  o.JumpQuirks,
+	}
+}
+
+// UnsupportedQuirks returns the names of the quirks that the options enable, but that
+// have no counterpart in the quirks of the CPU
+func (o Options) UnsupportedQuirks() []string {
+	var names []string
+	if o.VBlankQuirks {
+		names = append(names, "vBlankQuirks")
+	}
+	if o.VFOrderQuirks {
+		names = append(names, "vfOrderQuirks")
+	}
+	return names
+}
+
+// SetQuirks changes the options to select the quirks
+func (o *Options) SetQuirks(quirks chip8.Quirks) {
+	o.LogicQuirks = quirks.VFReset
+	o.LoadStoreQuirks = !quirks.Memory
+	o.ClipQuirks = quirks.Clipping
+	o.ShiftQuirks = quirks.Shifting
+	o.JumpQuirks = quirks.Jumping
+}
+
+// ClockRate returns the number of cycles per second
+func (o Options) ClockRate() int {
+	return o.TickRate * frameRate
+}
+
+// Palette returns the colors of the background and the planes
+func (o Options) Palette() (*io.Palette, error) {
+	var palette io.Palette
+	for i, s := range []string{o.BackgroundColor, o.FillColor, o.FillColor2, o.BlendColor} {
+		c, err := io.ParseColor(s)
+		if err != nil {
+			return nil, err
+		}
+		palette[i] = c
+	}
+	return &palette, nil
+}
+
+// SetPalette changes the options to use the colors of the palette
+func (o *Options) SetPalette(palette io.Palette) {
+	o.BackgroundColor = io.FormatColor(palette[0])
+	o.FillColor = io.FormatColor(palette[1])
+	o.FillColor2 = io.FormatColor(palette[2])
+	o.BlendColor = io.FormatColor(palette[3])
+}
+
+// IsCartridge reports whether the data is a GIF image, which may be a cartridge
+func IsCartridge(data []byte) bool {
+	return bytes.HasPrefix(data, []byte("GIF87a")) || bytes.HasPrefix(data, []byte("GIF89a"))
+}
+
+// LoadFile reads the cartridge from the GIF file
+func LoadFile(filename string) (*Cartridge, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to load cartridge %s: %v", filename, err)
+	}
+	return Decode(bytes.NewReader(data))
+}
+
+// Decode reads the cartridge from the GIF image
+func Decode(r goio.Reader) (*Cartridge, error) {
+	img, err := gif.DecodeAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to decode cartridge: %v", err)
+	}
+
+	// every byte is spread over four pixels, most significant bits first
+	var payload []byte
+	var b byte
+	n := 0
+	for _, frame := range img.Image {
+		for _, index := range frame.Pix {
+			b = b<<2 | index&0x3
+			n++
+			if n%4 == 0 {
+				payload = append(payload, b)
+			}
+		}
+	}
+
+	if len(payload) < 4 {
+		return nil, fmt.Errorf("Image is not a cartridge")
+	}
+	size := int(payload[0])<<24 | int(payload[1])<<16 | int(payload[2])<<8 | int(payload[3])
+	if size > len(payload)-4 {
+		return nil, fmt.Errorf("Image is not a cartridge")
+	}
+	cart := Cartridge{Options: DefaultOptions}
+	if err := json.Unmarshal(payload[4:4+size], &cart); err != nil {
+		return nil, fmt.Errorf("Image is not a cartridge: %v", err)
+	}
+	return &cart, nil
+}
+
+// Encode writes the cartridge as a GIF image, colored like the palette of its options
+func Encode(w goio.Writer, cart *Cartridge) error {
+	data, err := json.Marshal(cart)
+	if err != nil {
+		return err
+	}
+	size := len(data)
+	payload := append([]byte{byte(size >> 24), byte(size >> 16), byte(size >> 8), byte(size)}, data...)
+
+	height := (len(payload)*4 + width - 1) / width
+	if height < minHeight {
+		height = minHeight
+	}
+
+	// the upper bits of an index select the color of the artwork, the lower bits hold the data,
+	// which only varies the color slightly
+	palette, err := cart.Options.Palette()
+	if err != nil {
+		palette, _ = DefaultOptions.Palette()
+	}
+	colors := make(color.Palette, 0, 16)
+	for _, c := range palette {
+		for bits := 0; bits < 4; bits++ {
+			colors = append(colors, color.RGBA{R: shade(c.R, bits), G: shade(c.G, bits), B: shade(c.B, bits), A: 0xff})
+		}
+	}
+
+	img := image.NewPaletted(image.Rect(0, 0, width, height), colors)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			p := y*width + x
+			img.Pix[p] = artwork(x, y, height) << 2
+			if p/4 < len(payload) {
+				img.Pix[p] |= payload[p/4] >> uint(6-2*(p%4)) & 0x3
+			}
+		}
+	}
+	return gif.Encode(w, img, &gif.Options{NumColors: len(colors)})
+}
+
+// artwork returns the color of the cartridge at the pixel, a border in the second plane color
+func artwork(x, y, height int) byte {
+	if x < 4 || x >= width-4 || y < 4 || y >= height-4 {
+		return 2
+	}
+	return 0
+}
+
+// shade changes the intensity of the color component by a small amount
+func shade(v uint8, bits int) uint8 {
+	if int(v)+bits > 0xff {
+		return v - uint8(bits)
+	}
+	return v + uint8(bits)
+}
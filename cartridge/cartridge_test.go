@@ -0,0 +1,106 @@
+package cartridge_test
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/gif"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/arjenvanderende/chip8/cartridge"
+	"github.com/arjenvanderende/chip8/chip8"
+	"github.com/arjenvanderende/chip8/io"
+)
+
+func TestEncodeAndDecode(t *testing.T) {
+	custom := cartridge.DefaultOptions
+	custom.TickRate = 1000
+	custom.SetQuirks(chip8.Quirks{VFReset: true, Memory: true, Clipping: true})
+	custom.SetPalette(io.Palette{{R: 0x10, G: 0x20, B: 0x30}, {R: 0xff, G: 0xff, B: 0xff}, {}, {R: 0xff}})
+
+	invalidColors := cartridge.DefaultOptions
+	invalidColors.FillColor = "yellow"
+
+	tests := []struct {
+		name string
+		cart cartridge.Cartridge
+	}{
+		{"empty", cartridge.Cartridge{Options: cartridge.DefaultOptions}},
+		{"program", cartridge.Cartridge{Program: ": main\n  loop again\n", Options: cartridge.DefaultOptions}},
+		{"custom options", cartridge.Cartridge{Program: ": main exit", Options: custom}},
+		{"invalid colors", cartridge.Cartridge{Program: ": main exit", Options: invalidColors}},
+		{"taller than the minimum", cartridge.Cartridge{Program: strings.Repeat(": main exit\n", 1000), Options: cartridge.DefaultOptions}},
+	}
+	for _, test := range tests {
+		var buf bytes.Buffer
+		if err := cartridge.Encode(&buf, &test.cart); err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if !cartridge.IsCartridge(buf.Bytes()) {
+			t.Errorf("%s: IsCartridge() of the encoded cartridge is false", test.name)
+		}
+		cart, err := cartridge.Decode(&buf)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(*cart, test.cart) {
+			t.Errorf("%s: Decode() = %+v, expected %+v", test.name, *cart, test.cart)
+		}
+	}
+}
+
+func TestOptionsRoundTrip(t *testing.T) {
+	quirks := chip8.Quirks{VFReset: true, Shifting: true, Jumping: true}
+	palette := io.Palette{{R: 1, G: 2, B: 3, A: 0xff}, {R: 4, G: 5, B: 6, A: 0xff}, {R: 7, G: 8, B: 9, A: 0xff}, {R: 10, G: 11, B: 12, A: 0xff}}
+
+	var options cartridge.Options
+	options.SetQuirks(quirks)
+	options.SetPalette(palette)
+	if options.Quirks() != quirks {
+		t.Errorf("Quirks() = %+v, expected %+v", options.Quirks(), quirks)
+	}
+	p, err := options.Palette()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *p != palette {
+		t.Errorf("Palette() = %v, expected %v", *p, palette)
+	}
+}
+
+func TestDecodeRejectsOtherImages(t *testing.T) {
+	// a black image holds a payload of zero bytes, which is not a JSON object
+	img := image.NewPaletted(image.Rect(0, 0, 16, 16), color.Palette{color.Black, color.White})
+	var buf bytes.Buffer
+	if err := gif.Encode(&buf, img, nil); err != nil {
+		t.Fatal(err)
+	}
+	for name, data := range map[string][]byte{
+		"image":     buf.Bytes(),
+		"truncated": buf.Bytes()[:20],
+		"not a GIF": []byte("not an image"),
+	} {
+		if _, err := cartridge.Decode(bytes.NewReader(data)); err == nil {
+			t.Errorf("%s: Decode() succeeded, expected an error", name)
+		}
+	}
+}
+
+func TestUnsupportedQuirks(t *testing.T) {
+	options := cartridge.DefaultOptions
+	options.SetQuirks(chip8.Quirks{VFReset: true, Clipping: true})
+	if names := options.UnsupportedQuirks(); len(names) != 0 {
+		t.Errorf("UnsupportedQuirks() = %v, expected none", names)
+	}
+
+	options.VBlankQuirks = true
+	options.VFOrderQuirks = true
+	expected := []string{"vBlankQuirks", "vfOrderQuirks"}
+	if names := options.UnsupportedQuirks(); !reflect.DeepEqual(names, expected) {
+		t.Errorf("UnsupportedQuirks() = %v, expected %v", names, expected)
+	}
+}
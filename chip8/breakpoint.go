@@ -0,0 +1,231 @@
+package chip8
+
+import (
+	"fmt"
+	"strings"
+)
+
+// BreakType determines what triggers a breakpoint
+type BreakType int
+
+const (
+	// BreakPC triggers before the instruction at the address is executed
+	BreakPC BreakType = iota
+	// BreakRead triggers after an instruction reads from the memory range
+	BreakRead
+	// BreakWrite triggers after an instruction writes to the memory range
+	BreakWrite
+	// BreakAccess triggers after an instruction reads from or writes to the memory range
+	BreakAccess
+	// BreakRegister triggers after an instruction changes the value of the register
+	BreakRegister
+	// BreakCondition triggers after an instruction makes the condition true
+	BreakCondition
+)
+
+func (t BreakType) String() string {
+	switch t {
+	case BreakPC:
+		return "breakpoint"
+	case BreakRead:
+		return "read watchpoint"
+	case BreakWrite:
+		return "write watchpoint"
+	case BreakAccess:
+		return "access watchpoint"
+	case BreakRegister:
+		return "register watchpoint"
+	case BreakCondition:
+		return "condition"
+	}
+	return "unknown"
+}
+
+// Breakpoint stops the execution of the program when it is triggered
+type Breakpoint struct {
+	ID        int       // assigned by AddBreakpoint()
+	Type      BreakType // what triggers the breakpoint
+	Start     int       // the address of a PC breakpoint, or the first address of the memory range
+	End       int       // the last address of the memory range, 0 for a single address
+	Register  string    // the name of the register to watch, like "V3" or "I"
+	Condition string    // an optional expression, like "V3 == 0x10 && I > 0x300", that must be true to trigger
+
+	cond  expression
+	value int // the last value of the watched register or condition
+}
+
+// Hit describes the breakpoint that stopped the execution
+type Hit struct {
+	Breakpoint Breakpoint
+	PC         int // address of the instruction that triggered the breakpoint
+	Addr       int // address of the memory that was accessed, for memory watchpoints
+	Old        int // value of the register before the instruction, for register watchpoints
+	New        int // value of the register after the instruction, for register watchpoints
+}
+
+// Error describes the hit, so that Run() can report it
+func (h *Hit) Error() string {
+	bp := h.Breakpoint
+	switch bp.Type {
+	case BreakPC:
+		return fmt.Sprintf("Hit breakpoint %d at %04x", bp.ID, h.PC)
+	case BreakRead, BreakWrite, BreakAccess:
+		return fmt.Sprintf("Hit %s %d at %04x, accessed %04x", bp.Type, bp.ID, h.PC, h.Addr)
+	case BreakRegister:
+		return fmt.Sprintf("Hit %s %d at %04x, %s changed from %x to %x", bp.Type, bp.ID, h.PC, bp.Register, h.Old, h.New)
+	}
+	return fmt.Sprintf("Hit %s %d at %04x: %s", bp.Type, bp.ID, h.PC, bp.Condition)
+}
+
+// memoryAccess represents a range of memory that was accessed by an instruction
+type memoryAccess struct {
+	addr  int
+	n     int
+	write bool
+}
+
+// AddBreakpoint validates the breakpoint, adds it to the CPU and returns its ID
+func (cpu *CPU) AddBreakpoint(bp Breakpoint) (int, error) {
+	if bp.End < bp.Start {
+		bp.End = bp.Start
+	}
+	if bp.Type == BreakRegister {
+		bp.Register = strings.ToUpper(bp.Register)
+		if !isRegister(bp.Register) {
+			return 0, fmt.Errorf("Unknown register %s", bp.Register)
+		}
+		bp.value = cpu.registerValue(bp.Register)
+	}
+	if bp.Type == BreakCondition && bp.Condition == "" {
+		return 0, fmt.Errorf("Missing condition")
+	}
+	if bp.Condition != "" {
+		cond, err := parseExpression(bp.Condition)
+		if err != nil {
+			return 0, err
+		}
+		bp.cond = cond
+		bp.value = cond(cpu)
+	}
+
+	cpu.nextBreakID++
+	bp.ID = cpu.nextBreakID
+	cpu.breakpoints = append(cpu.breakpoints, bp)
+	return bp.ID, nil
+}
+
+// RemoveBreakpoint removes the breakpoint with the ID and reports whether it existed
+func (cpu *CPU) RemoveBreakpoint(id int) bool {
+	for i, bp := range cpu.breakpoints {
+		if bp.ID == id {
+			cpu.breakpoints = append(cpu.breakpoints[:i], cpu.breakpoints[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// Breakpoints returns the breakpoints of the CPU
+func (cpu *CPU) Breakpoints() []Breakpoint {
+	breakpoints := make([]Breakpoint, len(cpu.breakpoints))
+	copy(breakpoints, cpu.breakpoints)
+	return breakpoints
+}
+
+// touch records that the instruction accessed memory, so that watchpoints can be checked
+func (cpu *CPU) touch(addr uint16, n int, write bool) {
+	if len(cpu.breakpoints) > 0 {
+		cpu.accesses = append(cpu.accesses, memoryAccess{addr: int(addr), n: n, write: write})
+	}
+}
+
+// checkPCBreakpoints returns the first PC breakpoint at the instruction that is about to be executed.
+// The breakpoint that stopped the program is skipped when resuming, and instructions like Fx0A
+// that are executed repeatedly while waiting only trigger when they are reached.
+func (cpu *CPU) checkPCBreakpoints() *Hit {
+	resuming := cpu.resumePC == cpu.pc
+	cpu.resumePC = -1
+	if resuming || cpu.lastPC == cpu.pc {
+		return nil
+	}
+	for _, bp := range cpu.breakpoints {
+		if bp.Type != BreakPC || bp.Start != cpu.pc {
+			continue
+		}
+		if bp.cond != nil && bp.cond(cpu) == 0 {
+			continue
+		}
+		cpu.resumePC = cpu.pc
+		return &Hit{Breakpoint: bp, PC: cpu.pc}
+	}
+	return nil
+}
+
+// checkBreakpoints returns the first watchpoint or condition that was triggered by the instruction at pc
+func (cpu *CPU) checkBreakpoints(pc int) *Hit {
+	defer func() {
+		cpu.accesses = cpu.accesses[:0]
+	}()
+
+	var hit *Hit
+	for i := range cpu.breakpoints {
+		bp := &cpu.breakpoints[i]
+		h := cpu.triggered(bp, pc)
+		if h != nil && hit == nil {
+			hit = h
+		}
+	}
+	return hit
+}
+
+// triggered checks whether the breakpoint was triggered and updates the values that it watches
+func (cpu *CPU) triggered(bp *Breakpoint, pc int) *Hit {
+	hit := &Hit{PC: pc}
+	switch bp.Type {
+	case BreakPC:
+		// checked before the instruction is executed by checkPCBreakpoints()
+		return nil
+	case BreakRead, BreakWrite, BreakAccess:
+		addr, ok := cpu.accessed(bp)
+		if !ok {
+			return nil
+		}
+		hit.Addr = addr
+	case BreakRegister:
+		hit.Old = bp.value
+		hit.New = cpu.registerValue(bp.Register)
+		bp.value = hit.New
+		if hit.Old == hit.New {
+			return nil
+		}
+	case BreakCondition:
+		// only trigger when the condition becomes true
+		old := bp.value
+		bp.value = bp.cond(cpu)
+		if old != 0 || bp.value == 0 {
+			return nil
+		}
+	}
+
+	if bp.Type != BreakCondition && bp.cond != nil && bp.cond(cpu) == 0 {
+		return nil
+	}
+	hit.Breakpoint = *bp
+	return hit
+}
+
+// accessed returns the first address in the range of the watchpoint that the instruction accessed
+func (cpu *CPU) accessed(bp *Breakpoint) (int, bool) {
+	for _, access := range cpu.accesses {
+		if access.write && bp.Type == BreakRead || !access.write && bp.Type == BreakWrite {
+			continue
+		}
+		for addr := access.addr; addr < access.addr+access.n; addr++ {
+			a := addr & (memorySize - 1)
+			if a >= bp.Start && a <= bp.End {
+				return a, true
+			}
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,130 @@
+package chip8
+
+import (
+	"context"
+	"testing"
+
+	"github.com/arjenvanderende/chip8/io/headless"
+)
+
+// runUntilBreak steps the CPU until a breakpoint triggers or the number of instructions was executed
+func runUntilBreak(t *testing.T, cpu *CPU, cycles int) Result {
+	keyboard, err := headless.NewKeyboard(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := cpu.RunFor(cycles, headless.NewDisplay(), keyboard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return result
+}
+
+func TestBreakpoints(t *testing.T) {
+	tests := []struct {
+		name       string
+		breakpoint Breakpoint
+		hit        bool
+		pc         int  // address of the instruction that triggered the breakpoint
+		v0         byte // value of V0 when the breakpoint triggered
+		addr       int
+		old, new   int
+	}{
+		{"entry PC", Breakpoint{Type: BreakPC, Start: 0x200}, true, 0x200, 0, 0, 0, 0},
+		{"PC", Breakpoint{Type: BreakPC, Start: 0x204}, true, 0x204, 1, 0, 0, 0},
+		{"conditional PC", Breakpoint{Type: BreakPC, Start: 0x204, Condition: "V0 == 3"}, true, 0x204, 3, 0, 0, 0},
+		{"unreachable PC", Breakpoint{Type: BreakPC, Start: 0x208}, false, 0, 0, 0, 0, 0},
+		{"write", Breakpoint{Type: BreakWrite, Start: 0x300}, true, 0x204, 1, 0x300, 0, 0},
+		{"write range", Breakpoint{Type: BreakWrite, Start: 0x2ff, End: 0x301}, true, 0x204, 1, 0x300, 0, 0},
+		{"access", Breakpoint{Type: BreakAccess, Start: 0x300}, true, 0x204, 1, 0x300, 0, 0},
+		{"read", Breakpoint{Type: BreakRead, Start: 0x300}, false, 0, 0, 0, 0, 0},
+		{"register", Breakpoint{Type: BreakRegister, Register: "v0"}, true, 0x200, 1, 0, 0, 1},
+		{"register I", Breakpoint{Type: BreakRegister, Register: "I"}, true, 0x202, 1, 0, 0, 0x300},
+		{"condition", Breakpoint{Type: BreakCondition, Condition: "V0 == 2"}, true, 0x200, 2, 0, 0, 0},
+	}
+	for _, test := range tests {
+		cpu, err := LoadBytes(counterProgram, Quirks{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := cpu.AddBreakpoint(test.breakpoint); err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+
+		result := runUntilBreak(t, cpu, 100)
+		if !test.hit {
+			if result.Reason == StopBreak {
+				t.Errorf("%s: unexpected %v", test.name, result.Hit)
+			}
+			continue
+		}
+		if result.Reason != StopBreak {
+			t.Errorf("%s: breakpoint did not trigger", test.name)
+			continue
+		}
+		hit := result.Hit
+		if hit.PC != test.pc || cpu.v[0] != test.v0 || hit.Addr != test.addr || hit.Old != test.old || hit.New != test.new {
+			t.Errorf("%s: hit at %03x with V0=%d, addr=%03x, old=%x, new=%x, expected %03x with V0=%d, addr=%03x, old=%x, new=%x",
+				test.name, hit.PC, cpu.v[0], hit.Addr, hit.Old, hit.New, test.pc, test.v0, test.addr, test.old, test.new)
+		}
+	}
+}
+
+func TestPCBreakpointTriggersBeforeExecution(t *testing.T) {
+	cpu, err := LoadBytes(counterProgram, Quirks{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cpu.AddBreakpoint(Breakpoint{Type: BreakPC, Start: 0x200}); err != nil {
+		t.Fatal(err)
+	}
+
+	// the breakpoint at the entry PC triggers without executing the instruction
+	result := runUntilBreak(t, cpu, 1)
+	if result.Reason != StopBreak || result.Cycles != 0 || cpu.pc != 0x200 || cpu.v[0] != 0 {
+		t.Fatalf("First step: reason %v after %d cycles at %03x with V0=%d, expected a break before executing 200", result.Reason, result.Cycles, cpu.pc, cpu.v[0])
+	}
+
+	// resuming executes the instruction at the breakpoint and stops when the loop returns there
+	result = runUntilBreak(t, cpu, 100)
+	if result.Reason != StopBreak || result.Cycles != 4 || cpu.pc != 0x200 || cpu.v[0] != 1 {
+		t.Errorf("Resuming: reason %v after %d cycles at %03x with V0=%d, expected a break after 4 cycles with V0=1", result.Reason, result.Cycles, cpu.pc, cpu.v[0])
+	}
+}
+
+func TestPCBreakpointOnWaitingInstruction(t *testing.T) {
+	// LD V0, K waits for a key by executing repeatedly
+	cpu, err := LoadBytes([]byte{0xf0, 0x0a}, Quirks{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cpu.AddBreakpoint(Breakpoint{Type: BreakPC, Start: 0x200}); err != nil {
+		t.Fatal(err)
+	}
+	if result := runUntilBreak(t, cpu, 1); result.Reason != StopBreak {
+		t.Fatalf("Breakpoint at the waiting instruction did not trigger")
+	}
+	if result := runUntilBreak(t, cpu, 50); result.Reason == StopBreak {
+		t.Errorf("Breakpoint triggered again while the instruction was waiting")
+	}
+}
+
+func TestRunStopsAtEntryBreakpoint(t *testing.T) {
+	cpu, err := LoadBytes(counterProgram, Quirks{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cpu.SetVirtualClock(true)
+	if _, err := cpu.AddBreakpoint(Breakpoint{Type: BreakPC, Start: 0x200}); err != nil {
+		t.Fatal(err)
+	}
+	keyboard, err := headless.NewKeyboard(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = cpu.Run(context.Background(), headless.NewDisplay(), keyboard)
+	hit, ok := err.(*Hit)
+	if !ok || hit.PC != 0x200 || cpu.v[0] != 0 {
+		t.Errorf("Run() = %v with V0=%d, expected the breakpoint at 200 before executing it", err, cpu.v[0])
+	}
+}
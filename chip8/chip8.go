@@ -1,24 +1,37 @@
 package chip8
 
 import (
+	"context"
+	"crypto/sha1"
+	"errors"
 	"fmt"
+	goio "io"
 	"io/ioutil"
 	"log"
+	"math/bits"
 	"math/rand"
+	"os"
 	"time"
 
 	"github.com/arjenvanderende/chip8/io"
 )
 
 const (
-	// clockRate represents the number of operations that the CPU can process per second
-	clockRate int = 540
+	// defaultClockRate represents the number of operations that the CPU processes per second by default
+	defaultClockRate int = 540
+	// frameRate represents the number of times per second that the timers are decremented and the display is refreshed
+	frameRate int = 60
 	// programOffset represents the offset in memory where the program is loaded
 	programOffset int = 0x200
+	// bigDigitsOffset represents the offset in memory where the SUPER-CHIP font is loaded
+	bigDigitsOffset int = 0x50
+	// memorySize represents the size of the XO-CHIP address space in bytes
+	memorySize int = 0x10000
+	// MaxProgramSize represents the number of bytes that are available to load programs into
+	MaxProgramSize = memorySize - programOffset
 )
 
 var (
-	rnd    = rand.New(rand.NewSource(time.Now().UnixNano()))
 	digits = []byte{
 		0xf0, 0x90, 0x90, 0x90, 0xf0, // 0
 		0x20, 0x60, 0x20, 0x20, 0x70, // 1
@@ -37,10 +50,48 @@ var (
 		0xf0, 0x80, 0xf0, 0x80, 0xf0, // E
 		0xf0, 0x80, 0xf0, 0x80, 0x80, // F
 	}
+	bigDigits = []byte{
+		0xff, 0xff, 0xc3, 0xc3, 0xc3, 0xc3, 0xc3, 0xc3, 0xff, 0xff, // 0
+		0x18, 0x78, 0x78, 0x18, 0x18, 0x18, 0x18, 0x18, 0xff, 0xff, // 1
+		0xff, 0xff, 0x03, 0x03, 0xff, 0xff, 0xc0, 0xc0, 0xff, 0xff, // 2
+		0xff, 0xff, 0x03, 0x03, 0xff, 0xff, 0x03, 0x03, 0xff, 0xff, // 3
+		0xc3, 0xc3, 0xc3, 0xc3, 0xff, 0xff, 0x03, 0x03, 0x03, 0x03, // 4
+		0xff, 0xff, 0xc0, 0xc0, 0xff, 0xff, 0x03, 0x03, 0xff, 0xff, // 5
+		0xff, 0xff, 0xc0, 0xc0, 0xff, 0xff, 0xc3, 0xc3, 0xff, 0xff, // 6
+		0xff, 0xff, 0x03, 0x03, 0x06, 0x0c, 0x18, 0x18, 0x18, 0x18, // 7
+		0xff, 0xff, 0xc3, 0xc3, 0xff, 0xff, 0xc3, 0xc3, 0xff, 0xff, // 8
+		0xff, 0xff, 0xc3, 0xc3, 0xff, 0xff, 0x03, 0x03, 0xff, 0xff, // 9
+		0x7e, 0xff, 0xc3, 0xc3, 0xc3, 0xff, 0xff, 0xc3, 0xc3, 0xc3, // A
+		0xfc, 0xfc, 0xc3, 0xc3, 0xfc, 0xfc, 0xc3, 0xc3, 0xfc, 0xfc, // B
+		0x3c, 0xff, 0xc3, 0xc0, 0xc0, 0xc0, 0xc0, 0xc3, 0xff, 0x3c, // C
+		0xfc, 0xfe, 0xc3, 0xc3, 0xc3, 0xc3, 0xc3, 0xc3, 0xfe, 0xfc, // D
+		0xff, 0xff, 0xc0, 0xc0, 0xff, 0xff, 0xc0, 0xc0, 0xff, 0xff, // E
+		0xff, 0xff, 0xc0, 0xc0, 0xff, 0xff, 0xc0, 0xc0, 0xc0, 0xc0, // F
+	}
+
+	// errExit is returned by interpret() when the program requests to exit
+	errExit = errors.New("Program exited")
 )
 
-// Memory represents the memory address space of the Chip-8
-type Memory [0x1000]byte
+// Memory represents the memory address space of the Chip-8, extended to 64KB by XO-CHIP
+type Memory [memorySize]byte
+
+// read returns the byte at the address, wrapping around the end of the address space
+func (m *Memory) read(addr int) byte {
+	return m[addr&(memorySize-1)]
+}
+
+// slice returns n bytes starting at the address, wrapping around the end of the address space
+func (m *Memory) slice(addr uint16, n int) []byte {
+	if int(addr)+n <= memorySize {
+		return m[int(addr) : int(addr)+n]
+	}
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = m.read(int(addr) + i)
+	}
+	return b
+}
 
 // CPU represents the Chip8 CPU
 type CPU struct {
@@ -52,18 +103,66 @@ type CPU struct {
 	stack  [16]int
 	dt     byte // delay timer
 	st     byte // sound timer
+	quirks Quirks
+	rpl    [16]byte // SUPER-CHIP user flags, stored by Fx75 and loaded by Fx85
+	planes byte     // XO-CHIP bit planes selected by Fn01
+	screen io.Framebuffer
+
+	pattern [16]byte // XO-CHIP audio pattern buffer, loaded by F002
+	pitch   byte     // XO-CHIP audio pitch, set by Fx3A
+
+	rnd          *rand.Rand // random number generator for Cxnn
+	rndSource    *randomSource
+	clockRate    int  // number of operations per second
+	virtualClock bool // execute a fixed number of cycles per frame instead of following the wall clock
+	frameCycles  int  // number of cycles executed by Step() in the current frame
+	control      *Controller
+	rewind       *rewindBuffer // history of frames, nil when rewinding is disabled
+
+	breakpoints []Breakpoint
+	nextBreakID int
+	accesses    []memoryAccess // memory accessed by the current instruction, recorded for watchpoints
+	hit         *Hit           // the breakpoint that was triggered by the last instruction
+	lastPC      int            // address of the last executed instruction, -1 before the first one
+	resumePC    int            // address of the PC breakpoint that stopped the program, -1 when not stopped by one
 
 	programSize int
-	prevPC      int // program counter of previous interpret() call, used to detect multiple invocations when waiting for key press
+	romHash     [sha1.Size]byte // identifies the ROM in save states
+	prevPC      int             // program counter of previous interpret() call, used to detect multiple invocations when waiting for key press
 }
 
 // Load reads the program stored in the file into memory
-func Load(filename string) (*CPU, error) {
+func Load(filename string, quirks Quirks) (*CPU, error) {
 	// read ROM file
-	bytes, err := ioutil.ReadFile(filename)
+	f, err := os.Open(filename)
 	if err != nil {
 		return nil, fmt.Errorf("Unable to load Chip8 file %s: %v", filename, err)
 	}
+	defer f.Close()
+
+	cpu, err := LoadFrom(f, quirks)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to load Chip8 file %s: %v", filename, err)
+	}
+	return cpu, nil
+}
+
+// LoadFrom reads the program from r into memory, e.g. from stdin or an archive
+func LoadFrom(r goio.Reader, quirks Quirks) (*CPU, error) {
+	// read one byte more than fits, to detect programs that are too large without reading all of them
+	bytes, err := ioutil.ReadAll(goio.LimitReader(r, int64(MaxProgramSize+1)))
+	if err != nil {
+		return nil, err
+	}
+	return LoadBytes(bytes, quirks)
+}
+
+// LoadBytes copies the program into memory, e.g. after compiling it.
+// The quirks and clock rate that the ROM database lists for the program take precedence.
+func LoadBytes(bytes []byte, quirks Quirks) (*CPU, error) {
+	if len(bytes) > MaxProgramSize {
+		return nil, fmt.Errorf("Program does not fit in the %d bytes of memory above %#x", MaxProgramSize, programOffset)
+	}
 
 	// copy ROM into memory at program address
 	cpu := CPU{
@@ -74,46 +173,257 @@ func Load(filename string) (*CPU, error) {
 		sp:          0,
 		dt:          0,
 		st:          0,
+		quirks:      quirks,
+		planes:      0x1,
+		screen:      io.NewFramebuffer(io.LowRes),
+		pitch:       64,
+		clockRate:   defaultClockRate,
+		romHash:     sha1.Sum(bytes),
+		control:     &Controller{},
+		lastPC:      -1,
+		resumePC:    -1,
 	}
+	cpu.Seed(time.Now().UnixNano())
 	// copy digits for op: Fx29
 	for i, b := range digits {
 		cpu.memory[i] = b
 	}
+	// copy big digits for op: Fx30
+	for i, b := range bigDigits {
+		cpu.memory[bigDigitsOffset+i] = b
+	}
 	// copy program
 	for i, b := range bytes {
 		cpu.memory[programOffset+i] = b
 	}
+	cpu.applyROMInfo()
 	return &cpu, nil
 }
 
-// Run starts running the program
-func (cpu *CPU) Run(display io.Display, keyboard io.Keyboard) error {
-	clock := time.NewTicker(time.Second / time.Duration(clockRate))
+// Seed initialises the random number generator that is used by Cxnn,
+// so that the random numbers are the same for every run
+func (cpu *CPU) Seed(seed int64) {
+	cpu.rndSource = &randomSource{state: uint64(seed)}
+	cpu.rnd = rand.New(cpu.rndSource)
+}
+
+// SetVirtualClock selects whether the CPU executes a fixed number of cycles per frame.
+// When enabled, the timing of the program no longer depends on the scheduling of
+// wall clock tickers, which makes runs with the same seed and input reproducible.
+func (cpu *CPU) SetVirtualClock(enabled bool) {
+	cpu.virtualClock = enabled
+}
+
+// SetClockRate changes the number of operations that the CPU executes per second,
+// which is rounded down to a whole number of operations per frame
+func (cpu *CPU) SetClockRate(hz int) {
+	if hz < frameRate {
+		hz = frameRate
+	}
+	cpu.clockRate = hz / frameRate * frameRate
+}
+
+// Controller returns the controller that pauses, resumes and single-steps Run()
+func (cpu *CPU) Controller() *Controller {
+	return cpu.control
+}
+
+// Run starts running the program until it exits, the user quits or the context is cancelled.
+// When a breakpoint is triggered, Run stops and returns the *Hit that describes it.
+func (cpu *CPU) Run(ctx context.Context, display io.Display, keyboard io.Keyboard) error {
+	if cpu.virtualClock {
+		return cpu.runVirtual(ctx, display, keyboard)
+	}
+
+	clock := time.NewTicker(time.Second / time.Duration(cpu.clockRate))
 	defer clock.Stop()
 
-	frame := time.NewTicker(time.Second / time.Duration(60))
+	frame := time.NewTicker(time.Second / time.Duration(frameRate))
 	defer frame.Stop()
 
 	for {
 		select {
+		case <-ctx.Done():
+			return ctx.Err()
 		case <-clock.C:
-			// run the next tick of the program
-			err := cpu.interpret(display, keyboard)
-			if err != nil {
-				return fmt.Errorf("Could not interpret op: %v", err)
+			if cpu.control.Paused() && !cpu.control.takeStep() {
+				continue
 			}
-
-			// check if the user tried to quit the program
-			if keyboard.IsPressed(io.KeyEsc) {
-				return nil
+			reason, err := cpu.cycle(keyboard)
+			if reason == StopBreak {
+				return cpu.hit
+			}
+			if reason != StopNone || err != nil {
+				return err
+			}
+		case <-frame.C:
+			cpu.control.RunActions()
+			if cpu.control.Paused() {
+				display.Render(cpu.screen)
+				continue
 			}
-			keyboard.Tick()
+			cpu.frame(display, keyboard)
+		}
+	}
+}
+
+// runVirtual runs the program with a fixed number of cycles per frame,
+// only using the wall clock to pace the frames
+func (cpu *CPU) runVirtual(ctx context.Context, display io.Display, keyboard io.Keyboard) error {
+	frame := time.NewTicker(time.Second / time.Duration(frameRate))
+	defer frame.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
 		case <-frame.C:
-			// TODO: play sound with sound timer is active
-			cpu.decrementTimers()
-			display.Flush()
+			cpu.control.RunActions()
+			var result Result
+			var err error
+			if cpu.control.Paused() {
+				result, err = cpu.runSteps(display, keyboard)
+			} else {
+				result, err = cpu.RunFrame(display, keyboard)
+			}
+			if result.Reason == StopBreak {
+				return result.Hit
+			}
+			if result.Reason != StopNone || err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// runSteps executes the instructions that were requested by the controller while paused
+func (cpu *CPU) runSteps(display io.Display, keyboard io.Keyboard) (Result, error) {
+	var result Result
+	for cpu.control.takeStep() {
+		step, err := cpu.Step(display, keyboard)
+		result.add(step)
+		if result.Reason != StopNone || err != nil {
+			return result, err
 		}
 	}
+	display.Render(cpu.screen)
+	return result, nil
+}
+
+// Step executes a single instruction. The timers are decremented and the frame
+// is rendered on the display once every instruction that completes a frame.
+func (cpu *CPU) Step(display io.Display, keyboard io.Keyboard) (Result, error) {
+	result := Result{PC: cpu.pc, Last: cpu.fetch()}
+	reason, err := cpu.cycle(keyboard)
+	if err != nil {
+		return result, err
+	}
+	result.Reason = reason
+	if reason == StopBreak {
+		result.Hit = cpu.hit
+		if cpu.hit.Breakpoint.Type == BreakPC {
+			// the instruction at the breakpoint has not been executed yet
+			return result, nil
+		}
+	}
+	if reason == StopExit {
+		return result, nil
+	}
+	result.Cycles = 1
+
+	cpu.frameCycles++
+	if cpu.frameCycles >= cpu.clockRate/frameRate {
+		cpu.frameCycles = 0
+		cpu.frame(display, keyboard)
+		result.Frames = 1
+	}
+	return result, nil
+}
+
+// RunFrame executes the instructions until the current frame completes
+func (cpu *CPU) RunFrame(display io.Display, keyboard io.Keyboard) (Result, error) {
+	var result Result
+	for result.Frames == 0 {
+		step, err := cpu.Step(display, keyboard)
+		result.add(step)
+		if result.Reason != StopNone || err != nil {
+			return result, err
+		}
+	}
+	return result, nil
+}
+
+// RunFor executes the specified number of instructions
+func (cpu *CPU) RunFor(cycles int, display io.Display, keyboard io.Keyboard) (Result, error) {
+	var result Result
+	for result.Cycles < cycles {
+		step, err := cpu.Step(display, keyboard)
+		result.add(step)
+		if result.Reason != StopNone || err != nil {
+			return result, err
+		}
+	}
+	return result, nil
+}
+
+// cycle runs the next tick of the program and reports whether the program should stop
+func (cpu *CPU) cycle(keyboard io.Keyboard) (StopReason, error) {
+	// check if a breakpoint stops the program before the instruction is executed
+	cpu.hit = nil
+	if len(cpu.breakpoints) > 0 {
+		if cpu.hit = cpu.checkPCBreakpoints(); cpu.hit != nil {
+			return StopBreak, nil
+		}
+	}
+
+	pc := cpu.pc
+	err := cpu.interpret(keyboard)
+	cpu.lastPC = pc
+	if err == errExit {
+		return StopExit, nil
+	}
+	if err != nil {
+		return StopNone, fmt.Errorf("Could not interpret op: %v", err)
+	}
+
+	// check if the instruction triggered a watchpoint
+	if len(cpu.breakpoints) > 0 {
+		cpu.hit = cpu.checkBreakpoints(pc)
+	}
+
+	// check if the user tried to quit the program
+	if keyboard.IsPressed(io.KeyEsc) {
+		return StopQuit, nil
+	}
+	keyboard.Tick()
+	if cpu.hit != nil {
+		return StopBreak, nil
+	}
+	return StopNone, nil
+}
+
+// frame decrements the timers, renders the completed frame on the display and
+// tells keyboards that keep time in frames about the vertical blank
+func (cpu *CPU) frame(display io.Display, keyboard io.Keyboard) {
+	// TODO: play sound with sound timer is active
+	cpu.decrementTimers()
+	display.Render(cpu.screen)
+	if vblanker, ok := keyboard.(io.VBlanker); ok {
+		vblanker.VBlank()
+	}
+	if cpu.rewind != nil {
+		cpu.rewind.record(cpu)
+	}
+}
+
+// Framebuffer returns a copy of the contents of the display
+func (cpu *CPU) Framebuffer() io.Framebuffer {
+	return cpu.screen.Copy()
+}
+
+// Render shows the contents of the framebuffer on the display, also when the frame has not completed
+func (cpu *CPU) Render(display io.Display) {
+	display.Render(cpu.screen)
 }
 
 func (cpu *CPU) printState(pc int, op string) {
@@ -123,299 +433,382 @@ func (cpu *CPU) printState(pc int, op string) {
 	cpu.prevPC = pc
 }
 
-func (cpu *CPU) interpret(display io.Display, keyboard io.Keyboard) error {
-	op := cpu.DisassembleOp()
-	defer cpu.printState(cpu.pc, op)
-
-	nib1 := cpu.memory[cpu.pc] >> 4
-	vx := cpu.memory[cpu.pc] & 0x0f
-	vy := cpu.memory[cpu.pc+1] >> 4
-	n := cpu.memory[cpu.pc+1] & 0x0f
-	nn := cpu.memory[cpu.pc+1]
-	nnn := uint16(cpu.memory[cpu.pc]&0x0f)<<8 + uint16(cpu.memory[cpu.pc+1])
-
-	switch nib1 {
-	case 0x0:
-		switch cpu.memory[cpu.pc+1] {
-		case 0xe0:
-			display.Clear()
-		case 0xee:
-			cpu.sp--
-			cpu.pc = cpu.stack[cpu.sp]
-		default:
-			return fmt.Errorf("Unknown 0")
-		}
-	case 0x1:
-		cpu.pc = int(nnn)
+func (cpu *CPU) interpret(keyboard io.Keyboard) error {
+	in := cpu.fetch()
+	defer cpu.printState(cpu.pc, cpu.DisassembleOp())
+
+	switch in.Kind {
+	case OpSYS:
+		// machine code routines are not supported, ignore them like most interpreters do
+	case OpCLS:
+		cpu.screen.Clear()
+	case OpSCD:
+		cpu.screen.Scroll(0, int(in.N))
+	case OpSCU:
+		cpu.screen.Scroll(0, -int(in.N))
+	case OpSCR:
+		cpu.screen.Scroll(4, 0)
+	case OpSCL:
+		cpu.screen.Scroll(-4, 0)
+	case OpEXIT:
+		return errExit
+	case OpLOW:
+		cpu.screen.SetResolution(io.LowRes)
+	case OpHIGH:
+		cpu.screen.SetResolution(io.HighRes)
+	case OpRET:
+		cpu.sp--
+		cpu.pc = cpu.stack[cpu.sp]
+	case OpJP:
+		cpu.pc = int(in.NNN)
 		return nil
-	case 0x2:
+	case OpCALL:
 		cpu.stack[cpu.sp] = cpu.pc
 		cpu.sp++
-		cpu.pc = int(nnn)
+		cpu.pc = int(in.NNN)
 		return nil
-	case 0x3:
-		if cpu.v[vx] == nn {
-			cpu.pc += 2
+	case OpSEByte:
+		if cpu.v[in.X] == in.NN {
+			cpu.skip()
 		}
-	case 0x4:
-		if cpu.v[vx] != nn {
-			cpu.pc += 2
+	case OpSNEByte:
+		if cpu.v[in.X] != in.NN {
+			cpu.skip()
 		}
-	case 0x5:
-		if cpu.v[vx] == cpu.v[vy] {
-			cpu.pc += 2
+	case OpSEReg:
+		if cpu.v[in.X] == cpu.v[in.Y] {
+			cpu.skip()
 		}
-	case 0x6:
-		cpu.v[vx] = nn
-	case 0x7:
-		cpu.v[vx] = cpu.v[vx] + nn
-	case 0x8:
-		lastNib := cpu.memory[cpu.pc+1] & 0x0f
-		switch lastNib {
-		case 0x0:
-			cpu.v[vx] = cpu.v[vy]
-		case 0x1:
-			cpu.v[vx] = cpu.v[vx] | cpu.v[vy]
-		case 0x2:
-			cpu.v[vx] = cpu.v[vx] & cpu.v[vy]
-		case 0x3:
-			cpu.v[vx] = cpu.v[vx] ^ cpu.v[vy]
-		case 0x4:
-			// set carry flag
-			acc := int16(cpu.v[vx]) + int16(cpu.v[vy])
-			if acc > 255 {
-				cpu.v[0xf] = 1
-			} else {
-				cpu.v[0xf] = 0
-			}
-			cpu.v[vx] = byte(acc)
-		case 0x5:
-			// set borrow flag
-			if cpu.v[vx] > cpu.v[vy] {
-				cpu.v[0xf] = 1
-			} else {
-				cpu.v[0xf] = 0
-			}
-			cpu.v[vx] = cpu.v[vx] - cpu.v[vy]
-		case 0x6:
-			if cpu.v[vx]&0x1 > 0 {
-				cpu.v[0xf] = 1
-			} else {
-				cpu.v[0xf] = 0
-			}
-			cpu.v[vx] = cpu.v[vx] / 2
-		case 0x7:
-			// set borrow flag
-			if cpu.v[vy] > cpu.v[vx] {
-				cpu.v[0xf] = 1
-			} else {
-				cpu.v[0xf] = 0
-			}
-			cpu.v[vx] = cpu.v[vy] - cpu.v[vx]
-		case 0xe:
-			if cpu.v[vx]&0x80 > 0 {
-				cpu.v[0xf] = 1
-			} else {
-				cpu.v[0xf] = 0
-			}
-			cpu.v[vx] = cpu.v[vx] * 2
-		default:
-			return fmt.Errorf("Unknown 8: %1x", lastNib)
+	case OpSAVE:
+		registers := registerRange(in.X, in.Y)
+		for n, r := range registers {
+			cpu.memory[cpu.i+uint16(n)] = cpu.v[r]
+		}
+		cpu.touch(cpu.i, len(registers), true)
+	case OpLOAD:
+		registers := registerRange(in.X, in.Y)
+		for n, r := range registers {
+			cpu.v[r] = cpu.memory[cpu.i+uint16(n)]
+		}
+		cpu.touch(cpu.i, len(registers), false)
+	case OpLDByte:
+		cpu.v[in.X] = in.NN
+	case OpADDByte:
+		cpu.v[in.X] = cpu.v[in.X] + in.NN
+	case OpLDReg:
+		cpu.v[in.X] = cpu.v[in.Y]
+	case OpOR:
+		cpu.v[in.X] = cpu.v[in.X] | cpu.v[in.Y]
+		cpu.resetVF()
+	case OpAND:
+		cpu.v[in.X] = cpu.v[in.X] & cpu.v[in.Y]
+		cpu.resetVF()
+	case OpXOR:
+		cpu.v[in.X] = cpu.v[in.X] ^ cpu.v[in.Y]
+		cpu.resetVF()
+	case OpADDReg:
+		// set carry flag, after the result so that the flag wins when Vx is VF
+		acc := int(cpu.v[in.X]) + int(cpu.v[in.Y])
+		cpu.v[in.X] = byte(acc)
+		cpu.setVF(acc > 255)
+	case OpSUB:
+		// set no borrow flag
+		vx, vy := cpu.v[in.X], cpu.v[in.Y]
+		cpu.v[in.X] = vx - vy
+		cpu.setVF(vx >= vy)
+	case OpSHR:
+		v := cpu.shiftSource(in)
+		cpu.v[in.X] = v / 2
+		cpu.setVF(v&0x1 > 0)
+	case OpSUBN:
+		// set no borrow flag
+		vx, vy := cpu.v[in.X], cpu.v[in.Y]
+		cpu.v[in.X] = vy - vx
+		cpu.setVF(vy >= vx)
+	case OpSHL:
+		v := cpu.shiftSource(in)
+		cpu.v[in.X] = v * 2
+		cpu.setVF(v&0x80 > 0)
+	case OpSNEReg:
+		if cpu.v[in.X] != cpu.v[in.Y] {
+			cpu.skip()
 		}
-	case 0x9:
-		if cpu.v[vx] != cpu.v[vy] {
-			cpu.pc += 2
+	case OpLDI:
+		cpu.i = in.NNN
+	case OpLDILong:
+		cpu.i = in.NNNN
+	case OpJPV0:
+		if cpu.quirks.Jumping {
+			cpu.pc = int(in.NNN) + int(cpu.v[in.X])
+		} else {
+			cpu.pc = int(in.NNN) + int(cpu.v[0])
+		}
+		return nil
+	case OpRND:
+		cpu.v[in.X] = byte(cpu.rnd.Intn(256)) & in.NN
+	case OpDRW:
+		res := cpu.screen.Resolution
+		x := int(cpu.v[in.X]) % res.Width
+		y := int(cpu.v[in.Y]) % res.Height
+		width, height := 8, int(in.N)
+		if in.N == 0 {
+			// SUPER-CHIP draws a 16x16 sprite
+			width, height = 16, 16
+		}
+		// read the sprite of every selected plane
+		size := height * width / 8
+		var sprite []byte
+		for n := 0; n < bits.OnesCount8(cpu.planes); n++ {
+			data := cpu.memory.slice(cpu.i+uint16(n*size), size)
+			if cpu.quirks.Clipping {
+				data = clip(x, y, width, res, data)
+			}
+			sprite = append(sprite, data...)
 		}
-	case 0xa:
-		cpu.i = nnn
-	case 0xc:
-		cpu.v[vx] = byte(rnd.Intn(256)) & nn
-	case 0xd:
-		x := int(cpu.v[vx])
-		y := int(cpu.v[vy])
-		sprite := cpu.memory[cpu.i : cpu.i+uint16(n)]
-		collision := display.Draw(x, y, sprite)
+		cpu.touch(cpu.i, size*bits.OnesCount8(cpu.planes), false)
+		collision := cpu.screen.Draw(x, y, sprite, width)
 		if collision {
 			cpu.v[0xf] = 0x1
 		} else {
 			cpu.v[0xf] = 0x0
 		}
-	case 0xe:
-		switch cpu.memory[cpu.pc+1] {
-		case 0x9e:
-			if keyboard.IsPressed(io.Key(cpu.v[vx])) {
-				cpu.pc += 2
-			}
-		case 0xa1:
-			if !keyboard.IsPressed(io.Key(cpu.v[vx])) {
-				cpu.pc += 2
-			}
-		default:
-			return fmt.Errorf("Unknown E: %2x", cpu.memory[cpu.pc+1])
+	case OpSKP:
+		if keyboard.IsPressed(io.Key(cpu.v[in.X])) {
+			cpu.skip()
 		}
-	case 0xf:
-		switch cpu.memory[cpu.pc+1] {
-		case 0x07:
-			cpu.v[vx] = cpu.dt
-		case 0x0a:
-			key := keyboard.PressedButton()
-			if key == nil || io.IsOperationalKey(*key) {
-				// Skip processing the op at the current PC, allow the emulator
-				// to process the operational key and let it loop to the same
-				// op to start waiting for a key press again
-				return nil
-			}
-			cpu.v[vx] = byte(*key)
-		case 0x15:
-			cpu.dt = cpu.v[vx]
-		case 0x18:
-			cpu.st = cpu.v[vx]
-		case 0x1e:
-			cpu.i += uint16(cpu.v[vx])
-		case 0x29:
-			cpu.i = uint16(cpu.v[vx]) * 5
-		case 0x33:
-			v := uint16(cpu.v[vx])
-			cpu.memory[cpu.i+0] = byte((v / 100) % 10)
-			cpu.memory[cpu.i+1] = byte((v / 10) % 10)
-			cpu.memory[cpu.i+2] = byte(v % 10)
-		case 0x55:
-			for i := uint16(0); i <= uint16(vx); i++ {
-				cpu.memory[cpu.i+i] = cpu.v[i]
-			}
-		case 0x65:
-			for i := uint16(0); i <= uint16(vx); i++ {
-				cpu.v[i] = cpu.memory[cpu.i+i]
-			}
-		default:
-			return fmt.Errorf("Unknown F: %2x", cpu.memory[cpu.pc+1])
+	case OpSKNP:
+		if !keyboard.IsPressed(io.Key(cpu.v[in.X])) {
+			cpu.skip()
+		}
+	case OpPLANE:
+		// only the planes that the display supports can be selected
+		planes := in.X & (1<<io.PlaneCount - 1)
+		cpu.planes = planes
+		cpu.screen.SetPlanes(planes)
+	case OpAUDIO:
+		copy(cpu.pattern[:], cpu.memory.slice(cpu.i, len(cpu.pattern)))
+		cpu.touch(cpu.i, len(cpu.pattern), false)
+	case OpPITCH:
+		cpu.pitch = cpu.v[in.X]
+	case OpLDVxDT:
+		cpu.v[in.X] = cpu.dt
+	case OpLDVxK:
+		key := keyboard.PressedButton()
+		if key == nil || io.IsOperationalKey(*key) {
+			// Skip processing the op at the current PC, allow the emulator
+			// to process the operational key and let it loop to the same
+			// op to start waiting for a key press again
+			return nil
+		}
+		cpu.v[in.X] = byte(*key)
+	case OpLDDTVx:
+		cpu.dt = cpu.v[in.X]
+	case OpLDSTVx:
+		cpu.st = cpu.v[in.X]
+	case OpADDIVx:
+		cpu.i += uint16(cpu.v[in.X])
+	case OpLDFVx:
+		cpu.i = uint16(cpu.v[in.X]) * 5
+	case OpLDHFVx:
+		cpu.i = uint16(bigDigitsOffset) + uint16(cpu.v[in.X])*10
+	case OpLDBVx:
+		v := uint16(cpu.v[in.X])
+		cpu.memory[cpu.i+0] = byte((v / 100) % 10)
+		cpu.memory[cpu.i+1] = byte((v / 10) % 10)
+		cpu.memory[cpu.i+2] = byte(v % 10)
+		cpu.touch(cpu.i, 3, true)
+	case OpLDIVx:
+		for i := uint16(0); i <= uint16(in.X); i++ {
+			cpu.memory[cpu.i+i] = cpu.v[i]
+		}
+		cpu.touch(cpu.i, int(in.X)+1, true)
+		if cpu.quirks.Memory {
+			cpu.i += uint16(in.X) + 1
+		}
+	case OpLDVxI:
+		for i := uint16(0); i <= uint16(in.X); i++ {
+			cpu.v[i] = cpu.memory[cpu.i+i]
+		}
+		cpu.touch(cpu.i, int(in.X)+1, false)
+		if cpu.quirks.Memory {
+			cpu.i += uint16(in.X) + 1
+		}
+	case OpLDRVx:
+		for i := 0; i <= int(in.X); i++ {
+			cpu.rpl[i] = cpu.v[i]
+		}
+	case OpLDVxR:
+		for i := 0; i <= int(in.X); i++ {
+			cpu.v[i] = cpu.rpl[i]
 		}
 	default:
-		return fmt.Errorf("Unknown nib: %d", nib1)
+		return fmt.Errorf("Unknown op: %04x", in.Op)
 	}
 
-	cpu.pc += 2
+	cpu.pc += in.Size()
 	return nil
 }
 
+// skip jumps over the next instruction, which may be a 4-byte XO-CHIP instruction
+func (cpu *CPU) skip() {
+	cpu.pc += cpu.decodeAt(cpu.pc + 2).Size()
+}
+
+// registerRange returns the indices of the registers x through y, in descending order when y < x
+func registerRange(x, y byte) []byte {
+	var r []byte
+	for i := int(x); ; {
+		r = append(r, byte(i))
+		if i == int(y) {
+			return r
+		}
+		if x < y {
+			i++
+		} else {
+			i--
+		}
+	}
+}
+
+// setVF stores the flag of an arithmetic operation in VF
+func (cpu *CPU) setVF(flag bool) {
+	if flag {
+		cpu.v[0xf] = 1
+	} else {
+		cpu.v[0xf] = 0
+	}
+}
+
+// resetVF clears the flag register after a logical operation when the quirk is enabled
+func (cpu *CPU) resetVF() {
+	if cpu.quirks.VFReset {
+		cpu.v[0xf] = 0
+	}
+}
+
+// shiftSource returns the register value that a shift operation operates on
+func (cpu *CPU) shiftSource(in Instruction) byte {
+	if cpu.quirks.Shifting {
+		return cpu.v[in.X]
+	}
+	return cpu.v[in.Y]
+}
+
+// clip removes the parts of the sprite that would wrap around the edges of the display
+func clip(x, y, width int, res io.Resolution, sprite []byte) []byte {
+	bytesPerLine := width / 8
+	if y+len(sprite)/bytesPerLine > res.Height {
+		sprite = sprite[:(res.Height-y)*bytesPerLine]
+	}
+	if x+width <= res.Width {
+		return sprite
+	}
+	clipped := make([]byte, len(sprite))
+	for i, b := range sprite {
+		bx := x + (i%bytesPerLine)*8
+		switch {
+		case bx >= res.Width:
+			clipped[i] = 0
+		case bx+8 > res.Width:
+			clipped[i] = b & byte(0xff<<uint(bx+8-res.Width))
+		default:
+			clipped[i] = b
+		}
+	}
+	return clipped
+}
+
+// fetch decodes the operation at the PC
+func (cpu *CPU) fetch() Instruction {
+	return cpu.decodeAt(cpu.pc)
+}
+
+// decodeAt decodes the operation at the address
+func (cpu *CPU) decodeAt(addr int) Instruction {
+	in := Decode(uint16(cpu.memory.read(addr))<<8 | uint16(cpu.memory.read(addr+1)))
+	if in.Kind == OpLDILong {
+		in.NNNN = uint16(cpu.memory.read(addr+2))<<8 | uint16(cpu.memory.read(addr+3))
+	}
+	return in
+}
+
 func (cpu *CPU) decrementTimers() {
 	if cpu.dt > 0 {
 		cpu.dt--
 	}
 	if cpu.st > 0 {
-		cpu.dt--
+		cpu.st--
 	}
 }
 
-// NextOp increments the PC to the next operation
-// Returns false when there are no more operations to read
-func (cpu *CPU) NextOp() bool {
-	cpu.pc += 2
-	return cpu.pc <= programOffset+cpu.programSize
+// Program returns the bytes of the loaded program
+func (cpu *CPU) Program() []byte {
+	return cpu.ReadMemory(programOffset, cpu.programSize)
 }
 
 // DisassembleOp output the assembly for the operation at the PC.
 func (cpu *CPU) DisassembleOp() string {
-	nib1 := cpu.memory[cpu.pc] >> 4
-
-	vx := cpu.memory[cpu.pc] & 0x0f
-	vy := cpu.memory[cpu.pc+1] >> 4
-	n := cpu.memory[cpu.pc+1] & 0x0f
-	nn := cpu.memory[cpu.pc+1]
-	nnn := int16(cpu.memory[cpu.pc]&0x0f)<<8 + int16(cpu.memory[cpu.pc+1])
-
-	op := "not implemented"
-	switch nib1 {
-	case 0x0:
-		switch cpu.memory[cpu.pc+1] {
-		case 0xe0:
-			op = fmt.Sprintf("%-10s", "CLS")
-		case 0xee:
-			op = fmt.Sprintf("%-10s", "RET")
-		default:
-			op = fmt.Sprintf("%-10s %03x", "SYS", nnn)
-		}
-	case 0x1:
-		op = fmt.Sprintf("%-10s %03x", "JP", nnn)
-	case 0x2:
-		op = fmt.Sprintf("%-10s %03x", "CALL", nnn)
-	case 0x3:
-		op = fmt.Sprintf("%-10s V%01x, %02x", "SE", vx, nn)
-	case 0x4:
-		op = fmt.Sprintf("%-10s V%01x, %02x", "SNE", vx, nn)
-	case 0x5:
-		op = fmt.Sprintf("%-10s V%01x, V%01x", "SE", vx, vy)
-	case 0x6:
-		op = fmt.Sprintf("%-10s V%01x, %02x", "LD", vx, nn)
-	case 0x7:
-		op = fmt.Sprintf("%-10s V%01x, %02x", "ADD", vx, nn)
-	case 0x8:
-		lastNib := cpu.memory[cpu.pc+1] & 0x0f
-		switch lastNib {
-		case 0x0:
-			op = fmt.Sprintf("%-10s V%01x, V%01x", "LD", vx, vy)
-		case 0x1:
-			op = fmt.Sprintf("%-10s V%01x, V%01x", "OR", vx, vy)
-		case 0x2:
-			op = fmt.Sprintf("%-10s V%01x, V%01x", "AND", vx, vy)
-		case 0x3:
-			op = fmt.Sprintf("%-10s V%01x, V%01x", "XOR", vx, vy)
-		case 0x4:
-			op = fmt.Sprintf("%-10s V%01x, V%01x", "ADD", vx, vy)
-		case 0x5:
-			op = fmt.Sprintf("%-10s V%01x, V%01x, V%01x", "SUB", vx, vx, vy)
-		case 0x6:
-			op = fmt.Sprintf("%-10s V%01x, V%01x", "SHR", vx, vy)
-		case 0x7:
-			op = fmt.Sprintf("%-10s V%01x, V%01x, V%01x", "SUBN", vx, vy, vy)
-		case 0xe:
-			op = fmt.Sprintf("%-10s V%01x, V%01x", "SHL", vx, vy)
-		default:
-			op = fmt.Sprintf("UNKNOWN 8")
-		}
-	case 0x9:
-		op = fmt.Sprintf("%-10s V%01x, V%01x", "SNE", vx, vy)
-	case 0xa:
-		op = fmt.Sprintf("%-10s I,%03x", "LD", nnn)
-	case 0xb:
-		op = fmt.Sprintf("%-10s V0,%03x", "JP", nnn)
-	case 0xc:
-		op = fmt.Sprintf("%-10s V%01x, %02x", "RND", vx, nn)
-	case 0xd:
-		op = fmt.Sprintf("%-10s V%01x, V%01x, %01x", "DRW", vx, vy, n)
-	case 0xe:
-		switch cpu.memory[cpu.pc+1] {
-		case 0x9e:
-			op = fmt.Sprintf("%-10s V%01x", "SKP", vx)
-		case 0xa1:
-			op = fmt.Sprintf("%-10s V%01x", "SKNP", vx)
-		default:
-			op = fmt.Sprintf("UNKNOWN E")
-		}
-	case 0xf:
-		switch cpu.memory[cpu.pc+1] {
-		case 0x07:
-			op = fmt.Sprintf("%-10s V%01x, DELAY", "LD", vx)
-		case 0x0a:
-			op = fmt.Sprintf("%-10s V%01x, KEY", "LD", vx)
-		case 0x15:
-			op = fmt.Sprintf("%-10s DELAY, V%01x", "LD", vx)
-		case 0x18:
-			op = fmt.Sprintf("%-10s SOUND, V%01x", "LD", vx)
-		case 0x1e:
-			op = fmt.Sprintf("%-10s I, V%01x", "ADD", vx)
-		case 0x29:
-			op = fmt.Sprintf("%-10s F, V%01x", "LD", vx)
-		case 0x33:
-			op = fmt.Sprintf("%-10s B, V%01x", "LD", vx)
-		case 0x55:
-			op = fmt.Sprintf("%-10s [I], V%01x", "LD", vx)
-		case 0x65:
-			op = fmt.Sprintf("%-10s V%01x,[I]", "LD", vx)
-		default:
-			op = fmt.Sprintf("UNKNOWN F")
-		}
+	return cpu.DisassembleAt(cpu.pc)
+}
+
+// DisassembleAt outputs the assembly for the operation at the address.
+func (cpu *CPU) DisassembleAt(addr int) string {
+	return fmt.Sprintf("%04x %02x %02x %s", addr, cpu.memory.read(addr), cpu.memory.read(addr+1), cpu.decodeAt(addr))
+}
+
+// InstructionAt decodes the operation at the address
+func (cpu *CPU) InstructionAt(addr int) Instruction {
+	return cpu.decodeAt(addr)
+}
+
+// Registers represents the state of the registers of the CPU
+type Registers struct {
+	PC    int
+	I     uint16
+	V     [16]byte
+	SP    uint8
+	Stack []int // return addresses on the stack, the most recent one last
+	DT    byte
+	ST    byte
+}
+
+// Registers returns a copy of the registers of the CPU
+func (cpu *CPU) Registers() Registers {
+	stack := make([]int, cpu.sp)
+	copy(stack, cpu.stack[:cpu.sp])
+	return Registers{
+		PC:    cpu.pc,
+		I:     cpu.i,
+		V:     cpu.v,
+		SP:    cpu.sp,
+		Stack: stack,
+		DT:    cpu.dt,
+		ST:    cpu.st,
 	}
+}
 
-	return fmt.Sprintf("%04x %02x %02x %s", cpu.pc, cpu.memory[cpu.pc], cpu.memory[cpu.pc+1], op)
+// SetRegisters replaces the registers of the CPU, the length of the stack determines the SP
+func (cpu *CPU) SetRegisters(regs Registers) {
+	cpu.pc = regs.PC
+	cpu.i = regs.I
+	cpu.v = regs.V
+	cpu.sp = uint8(copy(cpu.stack[:], regs.Stack))
+	cpu.dt = regs.DT
+	cpu.st = regs.ST
+}
+
+// ReadMemory returns a copy of n bytes of memory starting at the address
+func (cpu *CPU) ReadMemory(addr, n int) []byte {
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = cpu.memory.read(addr + i)
+	}
+	return b
+}
+
+// WriteMemory copies the data into memory starting at the address
+func (cpu *CPU) WriteMemory(addr int, data []byte) {
+	for i, b := range data {
+		cpu.memory[(addr+i)&(memorySize-1)] = b
+	}
 }
@@ -0,0 +1,46 @@
+package chip8
+
+import "testing"
+
+func TestArithmeticFlags(t *testing.T) {
+	tests := []struct {
+		name   string
+		op     uint16
+		vx, vy byte // the values of Vx and Vy before the operation
+		result byte // the value of Vx after the operation, unless x is F
+		vf     byte
+	}{
+		{"add", 0x8014, 1, 2, 3, 0},
+		{"add with carry", 0x8014, 0xff, 2, 1, 1},
+		{"add into VF", 0x8f14, 0xff, 3, 2, 1},
+		{"sub", 0x8015, 5, 3, 2, 1},
+		{"sub of equal values", 0x8015, 3, 3, 0, 1},
+		{"sub with borrow", 0x8015, 3, 5, 0xfe, 0},
+		{"sub into VF", 0x8f15, 3, 5, 0, 0},
+		{"subn", 0x8017, 3, 5, 2, 1},
+		{"subn of equal values", 0x8017, 3, 3, 0, 1},
+		{"subn with borrow", 0x8017, 5, 3, 0xfe, 0},
+		{"subn into VF", 0x8f17, 5, 3, 0, 0},
+		{"shr", 0x8016, 0, 3, 1, 1},
+		{"shr into VF", 0x8f16, 0, 2, 0, 0},
+		{"shl", 0x801e, 0, 0x81, 2, 1},
+		{"shl into VF", 0x8f1e, 0, 0x40, 0, 0},
+	}
+	for _, test := range tests {
+		x := test.op >> 8 & 0xf
+		cpu := &CPU{pc: programOffset}
+		cpu.memory[programOffset] = byte(test.op >> 8)
+		cpu.memory[programOffset+1] = byte(test.op)
+		cpu.v[x] = test.vx
+		cpu.v[1] = test.vy
+		if err := cpu.interpret(nil); err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		if x != 0xf && cpu.v[x] != test.result {
+			t.Errorf("%s: V%X = %#x, expected %#x", test.name, x, cpu.v[x], test.result)
+		}
+		if cpu.v[0xf] != test.vf {
+			t.Errorf("%s: VF = %d, expected %d", test.name, cpu.v[0xf], test.vf)
+		}
+	}
+}
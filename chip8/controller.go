@@ -0,0 +1,89 @@
+package chip8
+
+import "sync"
+
+// Controller pauses, resumes and single-steps a running CPU from another goroutine
+type Controller struct {
+	mutex   sync.Mutex
+	paused  bool
+	steps   int      // number of instructions requested by Step() while paused
+	actions []func() // functions scheduled by Do()
+}
+
+// Pause suspends the execution of instructions and the timers
+func (c *Controller) Pause() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.paused = true
+}
+
+// Resume continues the execution after Pause()
+func (c *Controller) Resume() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.paused = false
+	c.steps = 0
+}
+
+// Toggle pauses a running CPU or resumes a paused CPU
+func (c *Controller) Toggle() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.paused = !c.paused
+	c.steps = 0
+}
+
+// Step executes a single instruction while the CPU is paused
+func (c *Controller) Step() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.paused {
+		c.steps++
+	}
+}
+
+// Paused reports whether the CPU is paused
+func (c *Controller) Paused() bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.paused
+}
+
+// Do schedules the action to run on the goroutine of Run() in between two instructions,
+// so that it can safely access the state of the CPU (e.g. to save or load a state)
+func (c *Controller) Do(action func()) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.actions = append(c.actions, action)
+}
+
+// RunActions runs the actions that were scheduled by Do(). Run() invokes it every frame,
+// other loops that drive the CPU (e.g. a debugger) have to invoke it themselves.
+func (c *Controller) RunActions() {
+	c.mutex.Lock()
+	actions := c.actions
+	c.actions = nil
+	c.mutex.Unlock()
+
+	for _, action := range actions {
+		action()
+	}
+}
+
+// takeStep consumes a requested step and reports whether it was available
+func (c *Controller) takeStep() bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.steps == 0 {
+		return false
+	}
+	c.steps--
+	return true
+}
@@ -0,0 +1,233 @@
+package chip8
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// expression evaluates a condition or value against the state of the CPU
+type expression func(cpu *CPU) int
+
+// binaryOperators lists the binary operators by precedence, from low to high
+var binaryOperators = [][]string{
+	{"||"},
+	{"&&"},
+	{"|"},
+	{"^"},
+	{"&"},
+	{"==", "!="},
+	{"<=", ">=", "<", ">"},
+	{"+", "-"},
+}
+
+// twoCharOperators lists the operators that consist of two characters
+var twoCharOperators = []string{"||", "&&", "==", "!=", "<=", ">="}
+
+// registerNames lists the registers that can be used in expressions and register watchpoints
+var registerNames = []string{
+	"V0", "V1", "V2", "V3", "V4", "V5", "V6", "V7",
+	"V8", "V9", "VA", "VB", "VC", "VD", "VE", "VF",
+	"I", "PC", "SP", "DT", "ST",
+}
+
+// registerValue returns the value of the register with the name, as listed in registerNames
+func (cpu *CPU) registerValue(name string) int {
+	switch name {
+	case "I":
+		return int(cpu.i)
+	case "PC":
+		return cpu.pc
+	case "SP":
+		return int(cpu.sp)
+	case "DT":
+		return int(cpu.dt)
+	case "ST":
+		return int(cpu.st)
+	}
+	r, _ := strconv.ParseUint(name[1:], 16, 8)
+	return int(cpu.v[r])
+}
+
+func isRegister(name string) bool {
+	for _, r := range registerNames {
+		if r == name {
+			return true
+		}
+	}
+	return false
+}
+
+// parseExpression parses expressions like "V3 == 0x10 && I > 0x300". Operands are
+// registers, numbers and bytes in memory written as [address]. Comparisons and
+// logical operators evaluate to 1 when true and 0 when false.
+func parseExpression(s string) (expression, error) {
+	p := &parser{tokens: tokenize(s)}
+	expr, err := p.parseBinary(0)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid expression %q: %v", s, err)
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("Invalid expression %q: unexpected %q", s, p.tokens[p.pos])
+	}
+	return expr, nil
+}
+
+// tokenize splits the expression into operators, brackets and words
+func tokenize(s string) []string {
+	var tokens []string
+	for i := 0; i < len(s); {
+		c := rune(s[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case unicode.IsLetter(c) || unicode.IsDigit(c):
+			j := i
+			for j < len(s) && (unicode.IsLetter(rune(s[j])) || unicode.IsDigit(rune(s[j]))) {
+				j++
+			}
+			tokens = append(tokens, s[i:j])
+			i = j
+		case i+1 < len(s) && contains(twoCharOperators, s[i:i+2]):
+			tokens = append(tokens, s[i:i+2])
+			i += 2
+		default:
+			tokens = append(tokens, s[i:i+1])
+			i++
+		}
+	}
+	return tokens
+}
+
+type parser struct {
+	tokens []string
+	pos    int
+}
+
+func (p *parser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+func (p *parser) parseBinary(level int) (expression, error) {
+	if level == len(binaryOperators) {
+		return p.parseUnary()
+	}
+	left, err := p.parseBinary(level + 1)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op := p.peek()
+		if !contains(binaryOperators[level], op) {
+			return left, nil
+		}
+		p.pos++
+		right, err := p.parseBinary(level + 1)
+		if err != nil {
+			return nil, err
+		}
+		left = binaryOperation(op, left, right)
+	}
+}
+
+func (p *parser) parseUnary() (expression, error) {
+	token := p.peek()
+	p.pos++
+	switch token {
+	case "":
+		return nil, fmt.Errorf("unexpected end")
+	case "!":
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return func(cpu *CPU) int { return boolToInt(operand(cpu) == 0) }, nil
+	case "-":
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return func(cpu *CPU) int { return -operand(cpu) }, nil
+	case "(":
+		expr, err := p.parseBinary(0)
+		if err != nil {
+			return nil, err
+		}
+		return expr, p.expect(")")
+	case "[":
+		addr, err := p.parseBinary(0)
+		if err != nil {
+			return nil, err
+		}
+		return func(cpu *CPU) int { return int(cpu.memory.read(addr(cpu))) }, p.expect("]")
+	}
+
+	name := strings.ToUpper(token)
+	if isRegister(name) {
+		return func(cpu *CPU) int { return cpu.registerValue(name) }, nil
+	}
+	n, err := strconv.ParseInt(token, 0, 32)
+	if err != nil {
+		return nil, fmt.Errorf("unexpected %q", token)
+	}
+	return func(cpu *CPU) int { return int(n) }, nil
+}
+
+func (p *parser) expect(token string) error {
+	if p.peek() != token {
+		return fmt.Errorf("expected %q", token)
+	}
+	p.pos++
+	return nil
+}
+
+func binaryOperation(op string, left, right expression) expression {
+	switch op {
+	case "||":
+		return func(cpu *CPU) int { return boolToInt(left(cpu) != 0 || right(cpu) != 0) }
+	case "&&":
+		return func(cpu *CPU) int { return boolToInt(left(cpu) != 0 && right(cpu) != 0) }
+	case "|":
+		return func(cpu *CPU) int { return left(cpu) | right(cpu) }
+	case "^":
+		return func(cpu *CPU) int { return left(cpu) ^ right(cpu) }
+	case "&":
+		return func(cpu *CPU) int { return left(cpu) & right(cpu) }
+	case "==":
+		return func(cpu *CPU) int { return boolToInt(left(cpu) == right(cpu)) }
+	case "!=":
+		return func(cpu *CPU) int { return boolToInt(left(cpu) != right(cpu)) }
+	case "<=":
+		return func(cpu *CPU) int { return boolToInt(left(cpu) <= right(cpu)) }
+	case ">=":
+		return func(cpu *CPU) int { return boolToInt(left(cpu) >= right(cpu)) }
+	case "<":
+		return func(cpu *CPU) int { return boolToInt(left(cpu) < right(cpu)) }
+	case ">":
+		return func(cpu *CPU) int { return boolToInt(left(cpu) > right(cpu)) }
+	case "+":
+		return func(cpu *CPU) int { return left(cpu) + right(cpu) }
+	default:
+		return func(cpu *CPU) int { return left(cpu) - right(cpu) }
+	}
+}
+
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,224 @@
+package chip8
+
+import "fmt"
+
+// Kind identifies the operation of a decoded instruction
+type Kind int
+
+// Operations that are supported by the CPU
+const (
+	OpUnknown Kind = iota
+	OpSYS          // 0nnn
+	OpCLS          // 00E0
+	OpRET          // 00EE
+	OpSCD          // 00Cn
+	OpSCU          // 00Dn
+	OpSCR          // 00FB
+	OpSCL          // 00FC
+	OpEXIT         // 00FD
+	OpLOW          // 00FE
+	OpHIGH         // 00FF
+	OpJP           // 1nnn
+	OpCALL         // 2nnn
+	OpSEByte       // 3xnn
+	OpSNEByte      // 4xnn
+	OpSEReg        // 5xy0
+	OpSAVE         // 5xy2
+	OpLOAD         // 5xy3
+	OpLDByte       // 6xnn
+	OpADDByte      // 7xnn
+	OpLDReg        // 8xy0
+	OpOR           // 8xy1
+	OpAND          // 8xy2
+	OpXOR          // 8xy3
+	OpADDReg       // 8xy4
+	OpSUB          // 8xy5
+	OpSHR          // 8xy6
+	OpSUBN         // 8xy7
+	OpSHL          // 8xyE
+	OpSNEReg       // 9xy0
+	OpLDI          // Annn
+	OpJPV0         // Bnnn
+	OpRND          // Cxnn
+	OpDRW          // Dxyn
+	OpSKP          // Ex9E
+	OpSKNP         // ExA1
+	OpLDILong      // F000 nnnn
+	OpPLANE        // Fn01
+	OpAUDIO        // F002
+	OpLDVxDT       // Fx07
+	OpLDVxK        // Fx0A
+	OpLDDTVx       // Fx15
+	OpLDSTVx       // Fx18
+	OpADDIVx       // Fx1E
+	OpLDFVx        // Fx29
+	OpLDHFVx       // Fx30
+	OpLDBVx        // Fx33
+	OpPITCH        // Fx3A
+	OpLDIVx        // Fx55
+	OpLDVxI        // Fx65
+	OpLDRVx        // Fx75
+	OpLDVxR        // Fx85
+)
+
+// Instruction represents a decoded operation
+type Instruction struct {
+	Kind Kind
+	Op   uint16 // the raw 16-bit opcode
+	X    byte   // register index in the second nibble
+	Y    byte   // register index in the third nibble
+	N    byte   // 4-bit constant in the last nibble
+	NN   byte   // 8-bit constant in the last byte
+	NNN  uint16 // 12-bit address in the last three nibbles
+	NNNN uint16 // 16-bit address in the word following F000
+}
+
+// decodeTable maps opcode bit patterns onto their kind.
+// Entries are matched in order, so more specific patterns must come first.
+var decodeTable = []struct {
+	mask, pattern uint16
+	kind          Kind
+}{
+	{0xffff, 0x00e0, OpCLS},
+	{0xffff, 0x00ee, OpRET},
+	{0xfff0, 0x00c0, OpSCD},
+	{0xfff0, 0x00d0, OpSCU},
+	{0xffff, 0x00fb, OpSCR},
+	{0xffff, 0x00fc, OpSCL},
+	{0xffff, 0x00fd, OpEXIT},
+	{0xffff, 0x00fe, OpLOW},
+	{0xffff, 0x00ff, OpHIGH},
+	{0xf000, 0x0000, OpSYS},
+	{0xf000, 0x1000, OpJP},
+	{0xf000, 0x2000, OpCALL},
+	{0xf000, 0x3000, OpSEByte},
+	{0xf000, 0x4000, OpSNEByte},
+	{0xf00f, 0x5002, OpSAVE},
+	{0xf00f, 0x5003, OpLOAD},
+	{0xf00f, 0x5000, OpSEReg},
+	{0xf000, 0x6000, OpLDByte},
+	{0xf000, 0x7000, OpADDByte},
+	{0xf00f, 0x8000, OpLDReg},
+	{0xf00f, 0x8001, OpOR},
+	{0xf00f, 0x8002, OpAND},
+	{0xf00f, 0x8003, OpXOR},
+	{0xf00f, 0x8004, OpADDReg},
+	{0xf00f, 0x8005, OpSUB},
+	{0xf00f, 0x8006, OpSHR},
+	{0xf00f, 0x8007, OpSUBN},
+	{0xf00f, 0x800e, OpSHL},
+	{0xf00f, 0x9000, OpSNEReg},
+	{0xf000, 0xa000, OpLDI},
+	{0xf000, 0xb000, OpJPV0},
+	{0xf000, 0xc000, OpRND},
+	{0xf000, 0xd000, OpDRW},
+	{0xf0ff, 0xe09e, OpSKP},
+	{0xf0ff, 0xe0a1, OpSKNP},
+	{0xffff, 0xf000, OpLDILong},
+	{0xffff, 0xf002, OpAUDIO},
+	{0xf0ff, 0xf001, OpPLANE},
+	{0xf0ff, 0xf007, OpLDVxDT},
+	{0xf0ff, 0xf00a, OpLDVxK},
+	{0xf0ff, 0xf015, OpLDDTVx},
+	{0xf0ff, 0xf018, OpLDSTVx},
+	{0xf0ff, 0xf01e, OpADDIVx},
+	{0xf0ff, 0xf029, OpLDFVx},
+	{0xf0ff, 0xf030, OpLDHFVx},
+	{0xf0ff, 0xf033, OpLDBVx},
+	{0xf0ff, 0xf03a, OpPITCH},
+	{0xf0ff, 0xf055, OpLDIVx},
+	{0xf0ff, 0xf065, OpLDVxI},
+	{0xf0ff, 0xf075, OpLDRVx},
+	{0xf0ff, 0xf085, OpLDVxR},
+}
+
+// mnemonics formats the assembly of each kind of instruction
+var mnemonics = map[Kind]func(in Instruction) string{
+	OpSYS:     func(in Instruction) string { return fmt.Sprintf("%-10s %03x", "SYS", in.NNN) },
+	OpCLS:     func(in Instruction) string { return fmt.Sprintf("%-10s", "CLS") },
+	OpRET:     func(in Instruction) string { return fmt.Sprintf("%-10s", "RET") },
+	OpSCD:     func(in Instruction) string { return fmt.Sprintf("%-10s %01x", "SCD", in.N) },
+	OpSCU:     func(in Instruction) string { return fmt.Sprintf("%-10s %01x", "SCU", in.N) },
+	OpSCR:     func(in Instruction) string { return fmt.Sprintf("%-10s", "SCR") },
+	OpSCL:     func(in Instruction) string { return fmt.Sprintf("%-10s", "SCL") },
+	OpEXIT:    func(in Instruction) string { return fmt.Sprintf("%-10s", "EXIT") },
+	OpLOW:     func(in Instruction) string { return fmt.Sprintf("%-10s", "LOW") },
+	OpHIGH:    func(in Instruction) string { return fmt.Sprintf("%-10s", "HIGH") },
+	OpJP:      func(in Instruction) string { return fmt.Sprintf("%-10s %03x", "JP", in.NNN) },
+	OpCALL:    func(in Instruction) string { return fmt.Sprintf("%-10s %03x", "CALL", in.NNN) },
+	OpSEByte:  func(in Instruction) string { return fmt.Sprintf("%-10s V%01x, %02x", "SE", in.X, in.NN) },
+	OpSNEByte: func(in Instruction) string { return fmt.Sprintf("%-10s V%01x, %02x", "SNE", in.X, in.NN) },
+	OpSEReg:   func(in Instruction) string { return fmt.Sprintf("%-10s V%01x, V%01x", "SE", in.X, in.Y) },
+	OpSAVE:    func(in Instruction) string { return fmt.Sprintf("%-10s V%01x, V%01x", "SAVE", in.X, in.Y) },
+	OpLOAD:    func(in Instruction) string { return fmt.Sprintf("%-10s V%01x, V%01x", "LOAD", in.X, in.Y) },
+	OpLDByte:  func(in Instruction) string { return fmt.Sprintf("%-10s V%01x, %02x", "LD", in.X, in.NN) },
+	OpADDByte: func(in Instruction) string { return fmt.Sprintf("%-10s V%01x, %02x", "ADD", in.X, in.NN) },
+	OpLDReg:   func(in Instruction) string { return fmt.Sprintf("%-10s V%01x, V%01x", "LD", in.X, in.Y) },
+	OpOR:      func(in Instruction) string { return fmt.Sprintf("%-10s V%01x, V%01x", "OR", in.X, in.Y) },
+	OpAND:     func(in Instruction) string { return fmt.Sprintf("%-10s V%01x, V%01x", "AND", in.X, in.Y) },
+	OpXOR:     func(in Instruction) string { return fmt.Sprintf("%-10s V%01x, V%01x", "XOR", in.X, in.Y) },
+	OpADDReg:  func(in Instruction) string { return fmt.Sprintf("%-10s V%01x, V%01x", "ADD", in.X, in.Y) },
+	OpSUB:     func(in Instruction) string { return fmt.Sprintf("%-10s V%01x, V%01x, V%01x", "SUB", in.X, in.X, in.Y) },
+	OpSHR:     func(in Instruction) string { return fmt.Sprintf("%-10s V%01x, V%01x", "SHR", in.X, in.Y) },
+	OpSUBN:    func(in Instruction) string { return fmt.Sprintf("%-10s V%01x, V%01x, V%01x", "SUBN", in.X, in.Y, in.Y) },
+	OpSHL:     func(in Instruction) string { return fmt.Sprintf("%-10s V%01x, V%01x", "SHL", in.X, in.Y) },
+	OpSNEReg:  func(in Instruction) string { return fmt.Sprintf("%-10s V%01x, V%01x", "SNE", in.X, in.Y) },
+	OpLDI:     func(in Instruction) string { return fmt.Sprintf("%-10s I,%03x", "LD", in.NNN) },
+	OpJPV0:    func(in Instruction) string { return fmt.Sprintf("%-10s V0,%03x", "JP", in.NNN) },
+	OpRND:     func(in Instruction) string { return fmt.Sprintf("%-10s V%01x, %02x", "RND", in.X, in.NN) },
+	OpDRW:     func(in Instruction) string { return fmt.Sprintf("%-10s V%01x, V%01x, %01x", "DRW", in.X, in.Y, in.N) },
+	OpSKP:     func(in Instruction) string { return fmt.Sprintf("%-10s V%01x", "SKP", in.X) },
+	OpSKNP:    func(in Instruction) string { return fmt.Sprintf("%-10s V%01x", "SKNP", in.X) },
+	OpLDILong: func(in Instruction) string { return fmt.Sprintf("%-10s I, LONG %04x", "LD", in.NNNN) },
+	OpPLANE:   func(in Instruction) string { return fmt.Sprintf("%-10s %01x", "PLANE", in.X) },
+	OpAUDIO:   func(in Instruction) string { return fmt.Sprintf("%-10s", "AUDIO") },
+	OpLDVxDT:  func(in Instruction) string { return fmt.Sprintf("%-10s V%01x, DELAY", "LD", in.X) },
+	OpLDVxK:   func(in Instruction) string { return fmt.Sprintf("%-10s V%01x, KEY", "LD", in.X) },
+	OpLDDTVx:  func(in Instruction) string { return fmt.Sprintf("%-10s DELAY, V%01x", "LD", in.X) },
+	OpLDSTVx:  func(in Instruction) string { return fmt.Sprintf("%-10s SOUND, V%01x", "LD", in.X) },
+	OpADDIVx:  func(in Instruction) string { return fmt.Sprintf("%-10s I, V%01x", "ADD", in.X) },
+	OpLDFVx:   func(in Instruction) string { return fmt.Sprintf("%-10s F, V%01x", "LD", in.X) },
+	OpLDHFVx:  func(in Instruction) string { return fmt.Sprintf("%-10s HF, V%01x", "LD", in.X) },
+	OpLDBVx:   func(in Instruction) string { return fmt.Sprintf("%-10s B, V%01x", "LD", in.X) },
+	OpPITCH:   func(in Instruction) string { return fmt.Sprintf("%-10s V%01x", "PITCH", in.X) },
+	OpLDIVx:   func(in Instruction) string { return fmt.Sprintf("%-10s [I], V%01x", "LD", in.X) },
+	OpLDVxI:   func(in Instruction) string { return fmt.Sprintf("%-10s V%01x,[I]", "LD", in.X) },
+	OpLDRVx:   func(in Instruction) string { return fmt.Sprintf("%-10s R, V%01x", "LD", in.X) },
+	OpLDVxR:   func(in Instruction) string { return fmt.Sprintf("%-10s V%01x, R", "LD", in.X) },
+}
+
+// Decode splits the opcode into its operands and determines the kind of operation
+func Decode(op uint16) Instruction {
+	in := Instruction{
+		Kind: OpUnknown,
+		Op:   op,
+		X:    byte(op>>8) & 0x0f,
+		Y:    byte(op>>4) & 0x0f,
+		N:    byte(op) & 0x0f,
+		NN:   byte(op),
+		NNN:  op & 0x0fff,
+	}
+	for _, entry := range decodeTable {
+		if op&entry.mask == entry.pattern {
+			in.Kind = entry.kind
+			break
+		}
+	}
+	return in
+}
+
+// Size returns the number of bytes that the instruction occupies in memory
+func (in Instruction) Size() int {
+	if in.Kind == OpLDILong {
+		return 4
+	}
+	return 2
+}
+
+// String outputs the assembly of the instruction
+func (in Instruction) String() string {
+	if format, ok := mnemonics[in.Kind]; ok {
+		return format(in)
+	}
+	return fmt.Sprintf("UNKNOWN %X", in.Op>>12)
+}
@@ -0,0 +1,41 @@
+package chip8
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDecode(t *testing.T) {
+	tests := []struct {
+		op       uint16
+		kind     Kind
+		mnemonic string
+	}{
+		{0x00e0, OpCLS, "CLS"},
+		{0x00c3, OpSCD, "SCD        3"},
+		{0x1234, OpJP, "JP         234"},
+		{0x5120, OpSEReg, "SE         V1, V2"},
+		{0x5121, OpUnknown, "UNKNOWN 5"},
+		{0x512f, OpUnknown, "UNKNOWN 5"},
+		{0x5122, OpSAVE, "SAVE       V1, V2"},
+		{0x5123, OpLOAD, "LOAD       V1, V2"},
+		{0x9ab0, OpSNEReg, "SNE        Va, Vb"},
+		{0x9ab1, OpUnknown, "UNKNOWN 9"},
+		{0x8126, OpSHR, "SHR        V1, V2"},
+		{0x8128, OpUnknown, "UNKNOWN 8"},
+		{0xb123, OpJPV0, "JP         V0,123"},
+		{0xf000, OpLDILong, "LD         I, LONG 0000"},
+		{0xf201, OpPLANE, "PLANE      2"},
+		{0xe19e, OpSKP, "SKP        V1"},
+		{0xe19f, OpUnknown, "UNKNOWN E"},
+	}
+	for _, test := range tests {
+		in := Decode(test.op)
+		if in.Kind != test.kind {
+			t.Errorf("Decode(%04x).Kind = %d, expected %d", test.op, in.Kind, test.kind)
+		}
+		if s := strings.TrimSpace(in.String()); s != test.mnemonic {
+			t.Errorf("Decode(%04x).String() = %q, expected %q", test.op, s, test.mnemonic)
+		}
+	}
+}
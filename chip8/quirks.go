@@ -0,0 +1,48 @@
+package chip8
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Quirks selects how the CPU interprets the operations whose behaviour
+// differs between the various Chip-8 implementations
+type Quirks struct {
+	// VFReset resets VF to 0 after the logical operations 8xy1, 8xy2 and 8xy3
+	VFReset bool `json:"vfReset"`
+	// Memory increments I past the last register that was stored or loaded by Fx55 and Fx65
+	Memory bool `json:"memory"`
+	// Clipping clips sprites at the edges of the display instead of wrapping them around
+	Clipping bool `json:"clipping"`
+	// Shifting shifts Vx in place for 8xy6 and 8xyE instead of shifting Vy into Vx
+	Shifting bool `json:"shifting"`
+	// Jumping makes Bnnn jump to nnn + Vx (with x the highest nibble of nnn) instead of nnn + V0
+	Jumping bool `json:"jumping"`
+}
+
+// QuirksPresets contains the quirks of well-known Chip-8 implementations
+var QuirksPresets = map[string]Quirks{
+	"default": {Shifting: true},
+	"vip":     {VFReset: true, Memory: true, Clipping: true},
+	"schip":   {Clipping: true, Shifting: true, Jumping: true},
+	"xochip":  {Memory: true},
+}
+
+// LookupQuirks returns the quirks of the preset with the specified name
+func LookupQuirks(name string) (Quirks, error) {
+	quirks, ok := QuirksPresets[name]
+	if !ok {
+		return Quirks{}, fmt.Errorf("Unknown quirks preset %s, expected one of %v", name, QuirksPresetNames())
+	}
+	return quirks, nil
+}
+
+// QuirksPresetNames returns the sorted names of the available presets
+func QuirksPresetNames() []string {
+	names := make([]string, 0, len(QuirksPresets))
+	for name := range QuirksPresets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,49 @@
+package chip8
+
+// StopReason describes why the CPU stopped executing instructions
+type StopReason int
+
+const (
+	// StopNone indicates that the CPU executed all instructions that were requested
+	StopNone StopReason = iota
+	// StopExit indicates that the program exited with 00FD
+	StopExit
+	// StopQuit indicates that the user pressed the ESC key
+	StopQuit
+	// StopBreak indicates that a breakpoint or watchpoint was triggered
+	StopBreak
+)
+
+func (r StopReason) String() string {
+	switch r {
+	case StopNone:
+		return "none"
+	case StopExit:
+		return "exit"
+	case StopQuit:
+		return "quit"
+	case StopBreak:
+		return "break"
+	}
+	return "unknown"
+}
+
+// Result describes the outcome of executing one or more instructions
+type Result struct {
+	Reason StopReason  // why the CPU stopped
+	Cycles int         // number of instructions that were executed
+	Frames int         // number of frames that were completed
+	PC     int         // address of the last instruction that was executed
+	Last   Instruction // last instruction that was executed
+	Hit    *Hit        // the breakpoint that stopped the CPU when the reason is StopBreak
+}
+
+// add accumulates the result of a subsequent step
+func (r *Result) add(step Result) {
+	r.Reason = step.Reason
+	r.Cycles += step.Cycles
+	r.Frames += step.Frames
+	r.PC = step.PC
+	r.Last = step.Last
+	r.Hit = step.Hit
+}
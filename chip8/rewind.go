@@ -0,0 +1,162 @@
+package chip8
+
+import (
+	"encoding/binary"
+
+	"github.com/arjenvanderende/chip8/io"
+)
+
+// memoryRunOverhead estimates the number of bytes that a memoryRun uses besides its data
+const memoryRunOverhead = 32
+
+// rewindFrame represents the state of the machine at the end of a frame
+type rewindFrame struct {
+	registers registerState
+	display   io.Framebuffer
+	// undo contains the memory of this frame that was overwritten in the next frame,
+	// it is empty for the most recent frame
+	undo []memoryRun
+}
+
+// memoryRun represents a range of consecutive bytes in memory
+type memoryRun struct {
+	addr int
+	data []byte
+}
+
+func (f *rewindFrame) size() int {
+	return binary.Size(f.registers) + len(f.display.Pixels) + undoSize(f.undo)
+}
+
+func undoSize(runs []memoryRun) int {
+	size := 0
+	for _, run := range runs {
+		size += memoryRunOverhead + len(run.data)
+	}
+	return size
+}
+
+// rewindBuffer records the state of the machine at the end of every frame in a ring buffer.
+// Only the most recent frame holds a copy of the whole memory, older frames store the bytes
+// that differ from the frame after it.
+type rewindBuffer struct {
+	frames []rewindFrame
+	start  int // index of the oldest frame
+	count  int // number of recorded frames
+	size   int // estimated number of bytes used by the recorded frames, including the copy of the memory
+	budget int // maximum number of bytes to use
+	memory Memory
+}
+
+func newRewindBuffer(depth, budget int) *rewindBuffer {
+	b := &rewindBuffer{
+		frames: make([]rewindFrame, depth),
+		budget: budget,
+	}
+	b.size = len(b.memory)
+	return b
+}
+
+// latest returns the most recently recorded frame
+func (b *rewindBuffer) latest() *rewindFrame {
+	return &b.frames[(b.start+b.count-1)%len(b.frames)]
+}
+
+// record adds the current state of the machine as the most recent frame
+func (b *rewindBuffer) record(cpu *CPU) {
+	if b.count > 0 {
+		latest := b.latest()
+		latest.undo = diffMemory(&b.memory, &cpu.memory)
+		b.size += undoSize(latest.undo)
+	}
+	b.memory = cpu.memory
+
+	// drop the oldest frame when the buffer is full
+	if b.count == len(b.frames) {
+		b.dropOldest()
+	}
+	b.count++
+	frame := b.latest()
+	*frame = rewindFrame{registers: cpu.saveRegisters(), display: cpu.screen.Copy()}
+	b.size += frame.size()
+
+	for b.size > b.budget && b.count > 1 {
+		b.dropOldest()
+	}
+}
+
+func (b *rewindBuffer) dropOldest() {
+	b.size -= b.frames[b.start].size()
+	b.frames[b.start] = rewindFrame{}
+	b.start = (b.start + 1) % len(b.frames)
+	b.count--
+}
+
+// rewind drops up to the specified number of recent frames and restores the machine
+// to the state of the most recent remaining frame. It returns the number of dropped frames.
+func (b *rewindBuffer) rewind(frames int, cpu *CPU) int {
+	if b.count == 0 {
+		return 0
+	}
+
+	dropped := 0
+	for ; dropped < frames && b.count > 1; dropped++ {
+		b.size -= b.latest().size()
+		*b.latest() = rewindFrame{}
+		b.count--
+
+		// restore the memory of the previous frame
+		latest := b.latest()
+		for _, run := range latest.undo {
+			copy(b.memory[run.addr:], run.data)
+		}
+		b.size -= undoSize(latest.undo)
+		latest.undo = nil
+	}
+
+	latest := b.latest()
+	cpu.loadRegisters(latest.registers)
+	cpu.memory = b.memory
+	cpu.screen = latest.display.Copy()
+	return dropped
+}
+
+// diffMemory returns the runs of bytes in a that differ from b
+func diffMemory(a, b *Memory) []memoryRun {
+	var runs []memoryRun
+	for addr := 0; addr < len(a); addr++ {
+		if a[addr] == b[addr] {
+			continue
+		}
+		end := addr + 1
+		for end < len(a) && a[end] != b[end] {
+			end++
+		}
+		data := make([]byte, end-addr)
+		copy(data, a[addr:end])
+		runs = append(runs, memoryRun{addr: addr, data: data})
+		addr = end
+	}
+	return runs
+}
+
+// EnableRewind starts recording the state of the machine at the end of every frame,
+// keeping at most depth frames that together use at most budget bytes. The budget includes
+// the copy of the whole memory, but the most recent frame is always kept. A depth below 1
+// disables rewinding.
+func (cpu *CPU) EnableRewind(depth, budget int) {
+	if depth < 1 {
+		cpu.rewind = nil
+		return
+	}
+	cpu.rewind = newRewindBuffer(depth, budget)
+}
+
+// Rewind steps the machine back in time by the number of frames and returns the
+// number of frames that it actually went back, limited by the recorded history
+func (cpu *CPU) Rewind(frames int) int {
+	if cpu.rewind == nil {
+		return 0
+	}
+	return cpu.rewind.rewind(frames, cpu)
+}
@@ -0,0 +1,98 @@
+package chip8
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/arjenvanderende/chip8/io"
+)
+
+// counterProgram stores an incrementing counter in memory, so every frame differs in memory
+var counterProgram = []byte{
+	0x70, 0x01, // 200: ADD V0, 01
+	0xa3, 0x00, // 202: LD I, 300
+	0xf0, 0x55, // 204: LD [I], V0
+	0x12, 0x00, // 206: JP 200
+}
+
+type rewindSnapshot struct {
+	registers Registers
+	memory    Memory
+	screen    io.Framebuffer
+}
+
+func TestRewindRestoresRecordedFrames(t *testing.T) {
+	cpu, err := LoadBytes(counterProgram, Quirks{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cpu.EnableRewind(10, 1<<20)
+
+	var snapshots []rewindSnapshot
+	for f := 0; f < 15; f++ {
+		runFrames(t, cpu, 1)
+		snapshots = append(snapshots, rewindSnapshot{cpu.Registers(), cpu.memory, cpu.Framebuffer()})
+	}
+
+	tests := []struct {
+		frames  int
+		dropped int
+	}{
+		{0, 0},
+		{1, 1},
+		{3, 3},
+		{100, 5}, // only 10 frames are kept, the oldest one remains
+	}
+	latest := len(snapshots) - 1
+	for _, test := range tests {
+		if dropped := cpu.Rewind(test.frames); dropped != test.dropped {
+			t.Errorf("Rewind(%d) = %d, expected %d", test.frames, dropped, test.dropped)
+		}
+		latest -= test.dropped
+		expected := snapshots[latest]
+		if !reflect.DeepEqual(cpu.Registers(), expected.registers) {
+			t.Errorf("Rewind(%d): registers = %+v, expected %+v", test.frames, cpu.Registers(), expected.registers)
+		}
+		if cpu.memory != expected.memory {
+			t.Errorf("Rewind(%d): memory differs from the recorded frame", test.frames)
+		}
+		if !reflect.DeepEqual(cpu.Framebuffer(), expected.screen) {
+			t.Errorf("Rewind(%d): framebuffer differs from the recorded frame", test.frames)
+		}
+	}
+}
+
+func TestRewindRespectsBudget(t *testing.T) {
+	cpu, err := LoadBytes(counterProgram, Quirks{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the budget only fits a few frames besides the copy of the memory
+	budget := len(Memory{}) + 16<<10
+	cpu.EnableRewind(100, budget)
+	runFrames(t, cpu, 50)
+	recorded := cpu.rewind.count
+	if recorded >= 50 || recorded < 2 {
+		t.Errorf("Recorded %d frames, expected the budget to limit them", recorded)
+	}
+	if cpu.rewind.size > budget {
+		t.Errorf("Recorded frames use %d bytes, expected at most %d", cpu.rewind.size, budget)
+	}
+	if dropped := cpu.Rewind(1000); dropped != recorded-1 {
+		t.Errorf("Rewind() dropped %d frames, expected %d", dropped, recorded-1)
+	}
+}
+
+func TestEnableRewindWithoutDepth(t *testing.T) {
+	for _, depth := range []int{0, -1} {
+		cpu, err := LoadBytes(counterProgram, Quirks{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		cpu.EnableRewind(depth, 1<<20)
+		runFrames(t, cpu, 3)
+		if dropped := cpu.Rewind(1); dropped != 0 {
+			t.Errorf("EnableRewind(%d): Rewind() = %d, expected 0", depth, dropped)
+		}
+	}
+}
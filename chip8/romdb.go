@@ -0,0 +1,142 @@
+package chip8
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"sync"
+)
+
+// ROMInfo describes a ROM and the settings that it needs to run correctly
+type ROMInfo struct {
+	Title     string            `json:"title"`
+	Author    string            `json:"author,omitempty"`
+	Platform  string            `json:"platform,omitempty"`  // the quirks preset, unless the quirks are listed
+	ClockRate int               `json:"clockRate,omitempty"` // the number of operations per second
+	Quirks    *Quirks           `json:"quirks,omitempty"`
+	Keys      map[string]string `json:"keys,omitempty"`   // keyboard characters mapped onto keypad keys 0-F
+	Colors    []string          `json:"colors,omitempty"` // background, plane 1, plane 2 and both planes as #rrggbb
+}
+
+// bundledROMs contains the ROMs that are known out of the box, in the format of ROM database files:
+// a JSON object that maps the hexadecimal SHA-1 hash of every ROM onto its info.
+// Only add ROMs whose hash was computed from the ROM file itself; TestBundledROMDatabase checks the entries.
+const bundledROMs = `{
+	"1ba58656810b67fd131eb9af3e3987863bf26c90": {"title": "IBM Logo", "platform": "vip"}
+}`
+
+var (
+	romDatabase      = mustParseROMDatabase(bundledROMs)
+	romDatabaseMutex sync.RWMutex
+)
+
+func mustParseROMDatabase(data string) map[string]ROMInfo {
+	roms, err := parseROMDatabase([]byte(data))
+	if err != nil {
+		panic(err)
+	}
+	return roms
+}
+
+func parseROMDatabase(data []byte) (map[string]ROMInfo, error) {
+	var roms map[string]ROMInfo
+	if err := json.Unmarshal(data, &roms); err != nil {
+		return nil, err
+	}
+	normalized := make(map[string]ROMInfo, len(roms))
+	for hash, info := range roms {
+		if b, err := hex.DecodeString(hash); err != nil || len(b) != len(CPU{}.romHash) {
+			return nil, fmt.Errorf("Invalid SHA-1 hash %s", hash)
+		}
+		if err := info.validate(); err != nil {
+			return nil, fmt.Errorf("Invalid ROM %s: %v", hash, err)
+		}
+		normalized[strings.ToLower(hash)] = info
+	}
+	return normalized, nil
+}
+
+// validate checks that the settings of the ROM can be applied
+func (info ROMInfo) validate() error {
+	if info.Platform != "" {
+		if _, ok := QuirksPresets[info.Platform]; !ok {
+			return fmt.Errorf("Unknown platform %s, expected one of %v", info.Platform, QuirksPresetNames())
+		}
+	}
+	if info.ClockRate < 0 {
+		return fmt.Errorf("Negative clock rate %d", info.ClockRate)
+	}
+	return nil
+}
+
+// LoadROMDatabase reads a ROM database file, whose entries take precedence over the bundled ones
+func LoadROMDatabase(filename string) error {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return fmt.Errorf("Unable to load ROM database: %v", err)
+	}
+	roms, err := parseROMDatabase(data)
+	if err != nil {
+		return fmt.Errorf("Unable to parse ROM database %s: %v", filename, err)
+	}
+
+	romDatabaseMutex.Lock()
+	defer romDatabaseMutex.Unlock()
+	for hash, info := range roms {
+		romDatabase[hash] = info
+	}
+	return nil
+}
+
+// LookupROM returns the info of the ROM with the hexadecimal SHA-1 hash
+func LookupROM(hash string) (ROMInfo, bool) {
+	romDatabaseMutex.RLock()
+	defer romDatabaseMutex.RUnlock()
+	info, ok := romDatabase[strings.ToLower(hash)]
+	return info, ok
+}
+
+// quirks returns the quirks that the ROM needs, if they are known
+func (info ROMInfo) quirks() (Quirks, bool) {
+	if info.Quirks != nil {
+		return *info.Quirks, true
+	}
+	quirks, ok := QuirksPresets[info.Platform]
+	return quirks, ok
+}
+
+// ROMHash returns the hexadecimal SHA-1 hash of the loaded ROM
+func (cpu *CPU) ROMHash() string {
+	return hex.EncodeToString(cpu.romHash[:])
+}
+
+// ROMInfo returns the info of the loaded ROM from the ROM database
+func (cpu *CPU) ROMInfo() (ROMInfo, bool) {
+	return LookupROM(cpu.ROMHash())
+}
+
+// applyROMInfo selects the quirks and clock rate that the ROM database lists for the loaded ROM
+func (cpu *CPU) applyROMInfo() {
+	info, ok := cpu.ROMInfo()
+	if !ok {
+		return
+	}
+	if quirks, ok := info.quirks(); ok {
+		cpu.quirks = quirks
+	}
+	if info.ClockRate > 0 {
+		cpu.SetClockRate(info.ClockRate)
+	}
+}
+
+// Quirks returns the quirks that the CPU emulates
+func (cpu *CPU) Quirks() Quirks {
+	return cpu.quirks
+}
+
+// SetQuirks changes the quirks that the CPU emulates
+func (cpu *CPU) SetQuirks(quirks Quirks) {
+	cpu.quirks = quirks
+}
@@ -0,0 +1,117 @@
+package chip8
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// ibmLogo is the well-known IBM Logo ROM
+var ibmLogo = []byte{
+	0x00, 0xe0, 0xa2, 0x2a, 0x60, 0x0c, 0x61, 0x08, 0xd0, 0x1f, 0x70, 0x09, 0xa2, 0x39, 0xd0, 0x1f,
+	0xa2, 0x48, 0x70, 0x08, 0xd0, 0x1f, 0x70, 0x04, 0xa2, 0x57, 0xd0, 0x1f, 0x70, 0x08, 0xa2, 0x66,
+	0xd0, 0x1f, 0x70, 0x08, 0xa2, 0x75, 0xd0, 0x1f, 0x12, 0x28, 0xff, 0x00, 0xff, 0x00, 0x3c, 0x00,
+	0x3c, 0x00, 0x3c, 0x00, 0x3c, 0x00, 0xff, 0x00, 0xff, 0xff, 0x00, 0xff, 0x00, 0x38, 0x00, 0x3f,
+	0x00, 0x3f, 0x00, 0x38, 0x00, 0xff, 0x00, 0xff, 0x80, 0x00, 0xe0, 0x00, 0xe0, 0x00, 0x80, 0x00,
+	0x80, 0x00, 0xe0, 0x00, 0xe0, 0x00, 0x80, 0xf8, 0x00, 0xfc, 0x00, 0x3e, 0x00, 0x3f, 0x00, 0x3b,
+	0x00, 0x39, 0x00, 0xf8, 0x00, 0xf8, 0x03, 0x00, 0x07, 0x00, 0x0f, 0x00, 0xbf, 0x00, 0xfb, 0x00,
+	0xf3, 0x00, 0xe3, 0x00, 0x43, 0xe0, 0x00, 0xe0, 0x00, 0x80, 0x00, 0x80, 0x00, 0x80, 0x00, 0x80,
+	0x00, 0xe0, 0x00, 0xe0,
+}
+
+// TestBundledROMDatabase checks that the bundled ROMs parse, because the package panics otherwise
+func TestBundledROMDatabase(t *testing.T) {
+	roms, err := parseROMDatabase([]byte(bundledROMs))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(roms) == 0 {
+		t.Fatal("Bundled ROM database is empty")
+	}
+	for hash, info := range roms {
+		if info.Title == "" {
+			t.Errorf("ROM %s has no title", hash)
+		}
+		if _, ok := info.quirks(); !ok {
+			t.Errorf("ROM %s (%s) has no platform or quirks", hash, info.Title)
+		}
+	}
+}
+
+func TestBundledROMIsDetected(t *testing.T) {
+	cpu, err := LoadBytes(ibmLogo, Quirks{Shifting: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, ok := cpu.ROMInfo()
+	if !ok || info.Title != "IBM Logo" {
+		t.Fatalf("ROMInfo() of %s = %+v, %v, expected the IBM Logo", cpu.ROMHash(), info, ok)
+	}
+	if cpu.Quirks() != QuirksPresets["vip"] {
+		t.Errorf("Quirks() = %+v, expected the vip preset", cpu.Quirks())
+	}
+}
+
+func TestParseROMDatabase(t *testing.T) {
+	const hash = "0123456789abcdef0123456789abcdef01234567"
+	tests := []struct {
+		name  string
+		data  string
+		valid bool
+	}{
+		{"empty", `{}`, true},
+		{"platform", `{"` + hash + `": {"title": "Test", "platform": "schip", "clockRate": 1200}}`, true},
+		{"quirks", `{"` + hash + `": {"title": "Test", "quirks": {"vfReset": true}}}`, true},
+		{"uppercase hash", `{"0123456789ABCDEF0123456789ABCDEF01234567": {"title": "Test"}}`, true},
+		{"short hash", `{"0123": {"title": "Test"}}`, false},
+		{"hash that is not hexadecimal", `{"0123456789abcdef0123456789abcdef0123456x": {"title": "Test"}}`, false},
+		{"unknown platform", `{"` + hash + `": {"title": "Test", "platform": "eti660"}}`, false},
+		{"negative clock rate", `{"` + hash + `": {"title": "Test", "clockRate": -1}}`, false},
+		{"not JSON", `{"`, false},
+	}
+	for _, test := range tests {
+		_, err := parseROMDatabase([]byte(test.data))
+		if (err == nil) != test.valid {
+			t.Errorf("%s: parseROMDatabase() error = %v, expected valid = %v", test.name, err, test.valid)
+		}
+	}
+}
+
+func TestLoadROMDatabaseAppliesSettings(t *testing.T) {
+	cpu, err := LoadBytes(testProgram, Quirks{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash := cpu.ROMHash()
+	defer func() {
+		romDatabaseMutex.Lock()
+		delete(romDatabase, hash)
+		romDatabaseMutex.Unlock()
+	}()
+
+	dir, err := ioutil.TempDir("", "romdb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "roms.json")
+	data := `{"` + hash + `": {"title": "Moving sprite", "platform": "vip", "clockRate": 1200}}`
+	if err := ioutil.WriteFile(filename, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := LoadROMDatabase(filename); err != nil {
+		t.Fatal(err)
+	}
+
+	cpu, err = LoadBytes(testProgram, Quirks{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info, ok := cpu.ROMInfo(); !ok || info.Title != "Moving sprite" {
+		t.Errorf("ROMInfo() = %+v, %v, expected the loaded ROM", info, ok)
+	}
+	if cpu.Quirks() != QuirksPresets["vip"] {
+		t.Errorf("Quirks() = %+v, expected the vip preset", cpu.Quirks())
+	}
+}
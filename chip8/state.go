@@ -0,0 +1,189 @@
+package chip8
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	goio "io"
+
+	"github.com/arjenvanderende/chip8/io"
+)
+
+const (
+	// stateMagic identifies a save state file
+	stateMagic = "CH8S"
+	// stateVersion represents the version of the save state format
+	stateVersion uint16 = 1
+)
+
+// stateHeader precedes the machine state in a save state
+type stateHeader struct {
+	Magic   [4]byte
+	Version uint16
+	ROMHash [20]byte
+}
+
+// machineState represents the machine state in version 1 of the save state format
+type machineState struct {
+	Registers registerState
+	Memory    Memory
+}
+
+// registerState represents the state of the machine besides its memory
+type registerState struct {
+	PC          uint32
+	I           uint16
+	V           [16]byte
+	SP          uint8
+	Stack       [16]uint32
+	DT          byte
+	ST          byte
+	RPL         [16]byte
+	Planes      byte
+	Pattern     [16]byte
+	Pitch       byte
+	Random      uint64
+	FrameCycles uint32
+}
+
+// displayState represents the contents of the display in version 1 of the save state format,
+// followed by width * height bytes of pixels
+type displayState struct {
+	Width  uint16
+	Height uint16
+	Planes byte
+}
+
+// SaveState writes the state of the machine, including the contents of the display, to w
+func (cpu *CPU) SaveState(w goio.Writer) error {
+	header := stateHeader{Version: stateVersion, ROMHash: cpu.romHash}
+	copy(header.Magic[:], stateMagic)
+
+	state := machineState{Registers: cpu.saveRegisters(), Memory: cpu.memory}
+	fb := cpu.screen
+	screen := displayState{
+		Width:  uint16(fb.Resolution.Width),
+		Height: uint16(fb.Resolution.Height),
+		Planes: fb.Planes,
+	}
+
+	for _, data := range []interface{}{header, state, screen, fb.Pixels} {
+		if err := binary.Write(w, binary.BigEndian, data); err != nil {
+			return fmt.Errorf("Unable to write save state: %v", err)
+		}
+	}
+	return nil
+}
+
+// LoadState restores the state of the machine and the contents of the display from r.
+// The state must have been saved while running the same ROM.
+func (cpu *CPU) LoadState(r goio.Reader) error {
+	var header stateHeader
+	if err := binary.Read(r, binary.BigEndian, &header); err != nil {
+		return fmt.Errorf("Unable to read save state: %v", err)
+	}
+	if !bytes.Equal(header.Magic[:], []byte(stateMagic)) {
+		return fmt.Errorf("Not a save state")
+	}
+	if header.Version != stateVersion {
+		return fmt.Errorf("Unsupported save state version %d, expected %d", header.Version, stateVersion)
+	}
+	if header.ROMHash != cpu.romHash {
+		return fmt.Errorf("Save state was created for a different ROM")
+	}
+
+	var state machineState
+	var screen displayState
+	if err := binary.Read(r, binary.BigEndian, &state); err != nil {
+		return fmt.Errorf("Unable to read save state: %v", err)
+	}
+	if err := binary.Read(r, binary.BigEndian, &screen); err != nil {
+		return fmt.Errorf("Unable to read save state: %v", err)
+	}
+	if err := state.Registers.validate(); err != nil {
+		return fmt.Errorf("Invalid save state: %v", err)
+	}
+	res := io.Resolution{Width: int(screen.Width), Height: int(screen.Height)}
+	if res != io.LowRes && res != io.HighRes {
+		return fmt.Errorf("Invalid save state: unsupported resolution %dx%d", res.Width, res.Height)
+	}
+	if screen.Planes > 1<<io.PlaneCount-1 {
+		return fmt.Errorf("Invalid save state: planes %#x out of range", screen.Planes)
+	}
+	fb := io.Framebuffer{
+		Resolution: res,
+		Planes:     screen.Planes,
+		Pixels:     make([]byte, res.Width*res.Height),
+	}
+	if _, err := goio.ReadFull(r, fb.Pixels); err != nil {
+		return fmt.Errorf("Unable to read save state: %v", err)
+	}
+
+	// only modify the machine once the whole state has been read
+	cpu.loadRegisters(state.Registers)
+	cpu.memory = state.Memory
+	cpu.screen = fb
+	return nil
+}
+
+// validate checks that the registers can be loaded without the machine addressing memory out of range
+func (state registerState) validate() error {
+	if state.PC >= uint32(memorySize) {
+		return fmt.Errorf("PC %#x out of range", state.PC)
+	}
+	if int(state.SP) > len(state.Stack) {
+		return fmt.Errorf("stack pointer %d out of range", state.SP)
+	}
+	for _, addr := range state.Stack[:state.SP] {
+		if addr >= uint32(memorySize) {
+			return fmt.Errorf("return address %#x out of range", addr)
+		}
+	}
+	if state.Planes > 1<<io.PlaneCount-1 {
+		return fmt.Errorf("planes %#x out of range", state.Planes)
+	}
+	return nil
+}
+
+func (cpu *CPU) saveRegisters() registerState {
+	state := registerState{
+		PC:          uint32(cpu.pc),
+		I:           cpu.i,
+		V:           cpu.v,
+		SP:          cpu.sp,
+		DT:          cpu.dt,
+		ST:          cpu.st,
+		RPL:         cpu.rpl,
+		Planes:      cpu.planes,
+		Pattern:     cpu.pattern,
+		Pitch:       cpu.pitch,
+		Random:      cpu.rndSource.state,
+		FrameCycles: uint32(cpu.frameCycles),
+	}
+	for i, addr := range cpu.stack {
+		state.Stack[i] = uint32(addr)
+	}
+	return state
+}
+
+func (cpu *CPU) loadRegisters(state registerState) {
+	cpu.pc = int(state.PC)
+	cpu.i = state.I
+	cpu.v = state.V
+	cpu.sp = state.SP
+	for i, addr := range state.Stack {
+		cpu.stack[i] = int(addr)
+	}
+	cpu.dt = state.DT
+	cpu.st = state.ST
+	cpu.rpl = state.RPL
+	cpu.planes = state.Planes
+	cpu.pattern = state.Pattern
+	cpu.pitch = state.Pitch
+	cpu.rndSource.state = state.Random
+	cpu.frameCycles = int(state.FrameCycles)
+
+	// the program arrives at the PC again, so a breakpoint there triggers
+	cpu.lastPC = -1
+	cpu.resumePC = -1
+}
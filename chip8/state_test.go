@@ -0,0 +1,150 @@
+package chip8
+
+import (
+	"bytes"
+	"encoding/binary"
+	"reflect"
+	"testing"
+
+	"github.com/arjenvanderende/chip8/io"
+	"github.com/arjenvanderende/chip8/io/headless"
+)
+
+// testProgram draws a sprite that moves to the right every iteration
+var testProgram = []byte{
+	0x60, 0x05, // 200: LD V0, 05
+	0xa2, 0x0a, // 202: LD I, 20A
+	0xd0, 0x15, // 204: DRW V0, V1, 5
+	0x70, 0x01, // 206: ADD V0, 01
+	0x12, 0x04, // 208: JP 204
+	0xf0, 0x90, 0x90, 0x90, 0xf0,
+}
+
+func newTestCPU(t *testing.T) *CPU {
+	cpu, err := LoadBytes(testProgram, Quirks{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cpu.Seed(1)
+	return cpu
+}
+
+func runFrames(t *testing.T, cpu *CPU, frames int) {
+	keyboard, err := headless.NewKeyboard(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for f := 0; f < frames; f++ {
+		if _, err := cpu.RunFrame(headless.NewDisplay(), keyboard); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestSaveAndLoadState(t *testing.T) {
+	cpu := newTestCPU(t)
+	runFrames(t, cpu, 3)
+
+	var buf bytes.Buffer
+	if err := cpu.SaveState(&buf); err != nil {
+		t.Fatal(err)
+	}
+	registers, memory, screen := cpu.Registers(), cpu.memory, cpu.Framebuffer()
+
+	runFrames(t, cpu, 5)
+	if err := cpu.LoadState(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(cpu.Registers(), registers) {
+		t.Errorf("Registers after loading = %+v, expected %+v", cpu.Registers(), registers)
+	}
+	if cpu.memory != memory {
+		t.Error("Memory after loading differs from the saved memory")
+	}
+	if !reflect.DeepEqual(cpu.Framebuffer(), screen) {
+		t.Error("Framebuffer after loading differs from the saved framebuffer")
+	}
+}
+
+func TestLoadStateRejectsCorruptInput(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(header *stateHeader, state *machineState, screen *displayState)
+	}{
+		{"magic", func(h *stateHeader, s *machineState, d *displayState) { copy(h.Magic[:], "XXXX") }},
+		{"version", func(h *stateHeader, s *machineState, d *displayState) { h.Version++ }},
+		{"ROM", func(h *stateHeader, s *machineState, d *displayState) { h.ROMHash[0]++ }},
+		{"PC", func(h *stateHeader, s *machineState, d *displayState) { s.Registers.PC = uint32(memorySize) }},
+		{"SP", func(h *stateHeader, s *machineState, d *displayState) { s.Registers.SP = 17 }},
+		{"return address", func(h *stateHeader, s *machineState, d *displayState) {
+			s.Registers.SP = 1
+			s.Registers.Stack[0] = 0xffffffff
+		}},
+		{"planes", func(h *stateHeader, s *machineState, d *displayState) { s.Registers.Planes = 4 }},
+		{"display planes", func(h *stateHeader, s *machineState, d *displayState) { d.Planes = 0xff }},
+		{"zero width", func(h *stateHeader, s *machineState, d *displayState) { d.Width = 0 }},
+		{"huge resolution", func(h *stateHeader, s *machineState, d *displayState) { d.Width, d.Height = 0xffff, 0xffff }},
+	}
+	for _, test := range tests {
+		cpu := newTestCPU(t)
+		runFrames(t, cpu, 2)
+		registers := cpu.Registers()
+
+		header := stateHeader{Version: stateVersion, ROMHash: cpu.romHash}
+		copy(header.Magic[:], stateMagic)
+		state := machineState{Registers: cpu.saveRegisters(), Memory: cpu.memory}
+		screen := displayState{Width: uint16(io.LowRes.Width), Height: uint16(io.LowRes.Height), Planes: 1}
+		test.modify(&header, &state, &screen)
+
+		var buf bytes.Buffer
+		for _, data := range []interface{}{header, state, screen, make([]byte, io.LowRes.Width*io.LowRes.Height)} {
+			if err := binary.Write(&buf, binary.BigEndian, data); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := cpu.LoadState(&buf); err == nil {
+			t.Errorf("%s: LoadState() succeeded, expected an error", test.name)
+		}
+		if !reflect.DeepEqual(cpu.Registers(), registers) {
+			t.Errorf("%s: LoadState() modified the registers", test.name)
+		}
+	}
+}
+
+func TestLoadStateRejectsTruncatedInput(t *testing.T) {
+	cpu := newTestCPU(t)
+	var buf bytes.Buffer
+	if err := cpu.SaveState(&buf); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+	for _, size := range []int{0, 10, len(data) / 2, len(data) - 1} {
+		if err := cpu.LoadState(bytes.NewReader(data[:size])); err == nil {
+			t.Errorf("LoadState() of %d out of %d bytes succeeded, expected an error", size, len(data))
+		}
+	}
+}
+
+// TestSaveStateAfterSelectingPlanes checks that the state of programs that select more planes
+// than the display supports can be loaded again
+func TestSaveStateAfterSelectingPlanes(t *testing.T) {
+	for _, n := range []byte{0x3, 0x4, 0xf} {
+		// PLANE n followed by an endless loop
+		cpu, err := LoadBytes([]byte{0xf0 | n, 0x01, 0x12, 0x02}, Quirks{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		runFrames(t, cpu, 1)
+		if cpu.planes != n&0x3 {
+			t.Errorf("PLANE %X selected planes %d, expected %d", n, cpu.planes, n&0x3)
+		}
+
+		var buf bytes.Buffer
+		if err := cpu.SaveState(&buf); err != nil {
+			t.Fatal(err)
+		}
+		if err := cpu.LoadState(&buf); err != nil {
+			t.Errorf("PLANE %X: LoadState() of the saved state: %v", n, err)
+		}
+	}
+}
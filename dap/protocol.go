@@ -0,0 +1,119 @@
+package dap
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// request represents a request from the client
+type request struct {
+	Seq       int             `json:"seq"`
+	Type      string          `json:"type"`
+	Command   string          `json:"command"`
+	Arguments json.RawMessage `json:"arguments"`
+}
+
+// response represents the reply to a request
+type response struct {
+	Seq        int         `json:"seq"`
+	Type       string      `json:"type"`
+	RequestSeq int         `json:"request_seq"`
+	Success    bool        `json:"success"`
+	Command    string      `json:"command"`
+	Message    string      `json:"message,omitempty"`
+	Body       interface{} `json:"body,omitempty"`
+}
+
+// event represents a notification to the client
+type event struct {
+	Seq   int         `json:"seq"`
+	Type  string      `json:"type"`
+	Event string      `json:"event"`
+	Body  interface{} `json:"body,omitempty"`
+}
+
+// connection reads requests from and writes responses and events to the client,
+// using the base protocol of Content-Length headers followed by a JSON body
+type connection struct {
+	r     *bufio.Reader
+	w     io.Writer
+	seq   int
+	mutex sync.Mutex
+}
+
+func newConnection(r io.Reader, w io.Writer) *connection {
+	return &connection{r: bufio.NewReader(r), w: w}
+}
+
+// read returns the next request of the client
+func (c *connection) read() (*request, error) {
+	length := -1
+	for {
+		line, err := c.r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			break
+		}
+		if strings.HasPrefix(line, "Content-Length:") {
+			length, err = strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, "Content-Length:")))
+			if err != nil {
+				return nil, fmt.Errorf("Invalid header %q", line)
+			}
+		}
+	}
+	if length < 0 {
+		return nil, fmt.Errorf("Missing Content-Length header")
+	}
+
+	body := make([]byte, length)
+	if _, err := io.ReadFull(c.r, body); err != nil {
+		return nil, err
+	}
+	var req request
+	if err := json.Unmarshal(body, &req); err != nil {
+		return nil, fmt.Errorf("Invalid request: %v", err)
+	}
+	return &req, nil
+}
+
+// respond sends a successful response with the body to the request
+func (c *connection) respond(req *request, body interface{}) error {
+	return c.write(&response{Type: "response", RequestSeq: req.Seq, Success: true, Command: req.Command, Body: body})
+}
+
+// fail sends an error response to the request
+func (c *connection) fail(req *request, message string) error {
+	return c.write(&response{Type: "response", RequestSeq: req.Seq, Success: false, Command: req.Command, Message: message})
+}
+
+// notify sends an event with the body
+func (c *connection) notify(name string, body interface{}) error {
+	return c.write(&event{Type: "event", Event: name, Body: body})
+}
+
+func (c *connection) write(msg interface{}) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.seq++
+	switch m := msg.(type) {
+	case *response:
+		m.Seq = c.seq
+	case *event:
+		m.Seq = c.seq
+	}
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(c.w, "Content-Length: %d\r\n\r\n%s", len(data), data)
+	return err
+}
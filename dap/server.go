@@ -0,0 +1,482 @@
+// Package dap serves the Debug Adapter Protocol, so that editors can debug programs
+// that run on the Chip-8. Breakpoints are set by source line when a source map of the
+// assembled program is available.
+package dap
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	goio "io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/arjenvanderende/chip8/chip8"
+	"github.com/arjenvanderende/chip8/io"
+	"github.com/arjenvanderende/chip8/sourcemap"
+)
+
+const (
+	// frameRate represents the number of frames per second that a running program executes
+	frameRate = 60
+	// threadID identifies the only thread of the Chip-8
+	threadID = 1
+	// variable references of the scopes
+	registersReference = 1
+	timersReference    = 2
+)
+
+// LoadFunc loads the program for a launch request
+type LoadFunc func(program string) (*chip8.CPU, error)
+
+// launchArguments contains the arguments of launch and attach requests
+type launchArguments struct {
+	Program     string `json:"program"`     // the ROM to load, only for launch requests
+	SourceMap   string `json:"sourceMap"`   // the source map of the program, defaults to the program with the .map extension
+	StopOnEntry bool   `json:"stopOnEntry"` // pause before executing the first instruction
+}
+
+type source struct {
+	Name string `json:"name,omitempty"`
+	Path string `json:"path,omitempty"`
+}
+
+type stackFrame struct {
+	ID                          int     `json:"id"`
+	Name                        string  `json:"name"`
+	Source                      *source `json:"source,omitempty"`
+	Line                        int     `json:"line"`
+	Column                      int     `json:"column"`
+	InstructionPointerReference string  `json:"instructionPointerReference"`
+}
+
+type variable struct {
+	Name               string `json:"name"`
+	Value              string `json:"value"`
+	VariablesReference int    `json:"variablesReference"`
+}
+
+type breakpoint struct {
+	ID       int    `json:"id,omitempty"`
+	Verified bool   `json:"verified"`
+	Line     int    `json:"line"`
+	Message  string `json:"message,omitempty"`
+}
+
+// Server debugs a program on behalf of an editor
+type Server struct {
+	cpu      *chip8.CPU
+	load     LoadFunc
+	display  io.Display
+	keyboard io.Keyboard
+	conn     *connection
+
+	sources     *sourcemap.Map
+	breakpoints map[string][]int // IDs of the breakpoints by source file
+
+	launched    bool // the client launched or attached to the program, which starts once it is configured
+	stopOnEntry bool
+
+	running bool
+	until   func(regs chip8.Registers) bool // stops running when it returns true, nil to run freely
+	reason  string                          // reason reported when until stops the program
+}
+
+// NewServer creates a server that debugs the program loaded into the CPU, or the
+// program loaded by the function when the client sends a launch request
+func NewServer(cpu *chip8.CPU, load LoadFunc, display io.Display, keyboard io.Keyboard) *Server {
+	return &Server{
+		cpu:         cpu,
+		load:        load,
+		display:     display,
+		keyboard:    keyboard,
+		breakpoints: make(map[string][]int),
+	}
+}
+
+// ListenAndServe waits for a client on the TCP address and serves it until it disconnects.
+// Addresses without a host, like ":4711", only listen on localhost.
+func (s *Server) ListenAndServe(ctx context.Context, addr string) error {
+	if strings.HasPrefix(addr, ":") {
+		addr = "localhost" + addr
+	}
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("Unable to listen for DAP clients: %v", err)
+	}
+	defer listener.Close()
+
+	go func() {
+		<-ctx.Done()
+		listener.Close()
+	}()
+
+	conn, err := listener.Accept()
+	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return fmt.Errorf("Unable to accept DAP client: %v", err)
+	}
+	defer conn.Close()
+
+	return s.Serve(ctx, conn, conn)
+}
+
+// Serve handles the requests that the client sends over r, e.g. stdin, until it disconnects
+func (s *Server) Serve(ctx context.Context, r goio.Reader, w goio.Writer) error {
+	s.conn = newConnection(r, w)
+	requests := make(chan *request)
+	errors := make(chan error, 1)
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			req, err := s.conn.read()
+			if err != nil {
+				errors <- err
+				return
+			}
+			// stop reading once the session has ended
+			select {
+			case requests <- req:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	frame := time.NewTicker(time.Second / time.Duration(frameRate))
+	defer frame.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case err := <-errors:
+			if err == goio.EOF {
+				return nil
+			}
+			return err
+		case req := <-requests:
+			done, err := s.handle(req)
+			if done || err != nil {
+				return err
+			}
+		case <-frame.C:
+			if s.running {
+				done, err := s.runFrame()
+				if done || err != nil {
+					return err
+				}
+			}
+		}
+	}
+}
+
+// handle executes the request and reports whether the session has ended
+func (s *Server) handle(req *request) (bool, error) {
+	switch req.Command {
+	case "initialize":
+		return false, s.conn.respond(req, map[string]interface{}{
+			"supportsConfigurationDoneRequest": true,
+		})
+	case "launch", "attach":
+		return false, s.launch(req)
+	case "configurationDone":
+		if err := s.conn.respond(req, nil); err != nil {
+			return false, err
+		}
+		return false, s.start()
+	case "setBreakpoints":
+		return false, s.setBreakpoints(req)
+	case "threads":
+		return false, s.conn.respond(req, map[string]interface{}{
+			"threads": []map[string]interface{}{{"id": threadID, "name": "Chip-8"}},
+		})
+	case "stackTrace":
+		return false, s.stackTrace(req)
+	case "scopes":
+		return false, s.conn.respond(req, map[string]interface{}{
+			"scopes": []map[string]interface{}{
+				{"name": "Registers", "variablesReference": registersReference, "expensive": false},
+				{"name": "Timers", "variablesReference": timersReference, "expensive": false},
+			},
+		})
+	case "variables":
+		return false, s.variables(req)
+	case "continue":
+		s.resume(nil, "")
+		return false, s.conn.respond(req, map[string]interface{}{"allThreadsContinued": true})
+	case "pause":
+		if err := s.conn.respond(req, nil); err != nil {
+			return false, err
+		}
+		return false, s.stop("pause", "")
+	case "next":
+		return s.step(req, s.stepOver)
+	case "stepIn":
+		return s.step(req, nil)
+	case "stepOut":
+		depth := len(s.cpu.Registers().Stack)
+		return s.step(req, func() {
+			s.resume(func(regs chip8.Registers) bool { return len(regs.Stack) < depth }, "step")
+		})
+	case "disconnect":
+		return true, s.conn.respond(req, nil)
+	}
+	return false, s.conn.fail(req, fmt.Sprintf("Unsupported command %s", req.Command))
+}
+
+func (s *Server) launch(req *request) error {
+	var args launchArguments
+	if len(req.Arguments) > 0 {
+		if err := json.Unmarshal(req.Arguments, &args); err != nil {
+			return s.conn.fail(req, err.Error())
+		}
+	}
+
+	if req.Command == "launch" && args.Program != "" {
+		if s.load == nil {
+			return s.conn.fail(req, "Launching programs is not supported")
+		}
+		cpu, err := s.load(args.Program)
+		if err != nil {
+			return s.conn.fail(req, err.Error())
+		}
+		s.cpu = cpu
+		s.cpu.Render(s.display)
+		s.breakpoints = make(map[string][]int)
+	}
+
+	// load the source map of the program, it is optional unless it was specified explicitly
+	mapfile := args.SourceMap
+	if mapfile == "" && args.Program != "" {
+		mapfile = strings.TrimSuffix(args.Program, filepath.Ext(args.Program)) + ".map"
+		if _, err := os.Stat(mapfile); err != nil {
+			mapfile = ""
+		}
+	}
+	if mapfile != "" {
+		sources, err := sourcemap.Load(mapfile)
+		if err != nil {
+			return s.conn.fail(req, err.Error())
+		}
+		s.sources = sources
+	}
+
+	if err := s.conn.respond(req, nil); err != nil {
+		return err
+	}
+	// the program starts once the client has set its breakpoints and sends configurationDone
+	s.launched = true
+	s.stopOnEntry = args.StopOnEntry
+	return s.conn.notify("initialized", nil)
+}
+
+// start runs the launched program, or pauses it at its entry when requested
+func (s *Server) start() error {
+	if !s.launched {
+		return nil
+	}
+	s.launched = false
+	if s.stopOnEntry {
+		return s.stop("entry", "")
+	}
+	s.resume(nil, "")
+	return nil
+}
+
+func (s *Server) setBreakpoints(req *request) error {
+	var args struct {
+		Source      source `json:"source"`
+		Breakpoints []struct {
+			Line      int    `json:"line"`
+			Condition string `json:"condition"`
+		} `json:"breakpoints"`
+	}
+	if err := json.Unmarshal(req.Arguments, &args); err != nil {
+		return s.conn.fail(req, err.Error())
+	}
+
+	// replace the breakpoints of the source file
+	for _, id := range s.breakpoints[args.Source.Path] {
+		s.cpu.RemoveBreakpoint(id)
+	}
+	ids := []int{}
+	result := []breakpoint{}
+	for _, bp := range args.Breakpoints {
+		b := breakpoint{Line: bp.Line}
+		addr, ok := 0, false
+		if s.sources != nil {
+			addr, ok = s.sources.Addr(args.Source.Path, bp.Line)
+		}
+		if !ok {
+			b.Message = "No instruction on this line"
+			result = append(result, b)
+			continue
+		}
+
+		id, err := s.cpu.AddBreakpoint(chip8.Breakpoint{Type: chip8.BreakPC, Start: addr, Condition: bp.Condition})
+		if err != nil {
+			b.Message = err.Error()
+		} else {
+			b.ID = id
+			b.Verified = true
+			ids = append(ids, id)
+		}
+		result = append(result, b)
+	}
+	s.breakpoints[args.Source.Path] = ids
+	return s.conn.respond(req, map[string]interface{}{"breakpoints": result})
+}
+
+func (s *Server) stackTrace(req *request) error {
+	regs := s.cpu.Registers()
+
+	// the current instruction, followed by the CALL instructions on the stack
+	addrs := []int{regs.PC}
+	for i := len(regs.Stack) - 1; i >= 0; i-- {
+		addrs = append(addrs, regs.Stack[i])
+	}
+
+	frames := make([]stackFrame, len(addrs))
+	for i, addr := range addrs {
+		frames[i] = stackFrame{
+			ID:                          i,
+			Name:                        fmt.Sprintf("%04x", addr),
+			InstructionPointerReference: fmt.Sprintf("0x%04x", addr),
+		}
+		if s.sources == nil {
+			continue
+		}
+		if symbol, ok := s.sources.Symbol(addr); ok {
+			frames[i].Name = fmt.Sprintf("%s (%04x)", symbol, addr)
+		}
+		if line, ok := s.sources.Line(addr); ok {
+			frames[i].Source = &source{Name: filepath.Base(line.File), Path: line.File}
+			frames[i].Line = line.Line
+			frames[i].Column = 1
+		}
+	}
+	return s.conn.respond(req, map[string]interface{}{"stackFrames": frames, "totalFrames": len(frames)})
+}
+
+func (s *Server) variables(req *request) error {
+	var args struct {
+		VariablesReference int `json:"variablesReference"`
+	}
+	if err := json.Unmarshal(req.Arguments, &args); err != nil {
+		return s.conn.fail(req, err.Error())
+	}
+
+	regs := s.cpu.Registers()
+	vars := []variable{}
+	switch args.VariablesReference {
+	case registersReference:
+		for i, v := range regs.V {
+			vars = append(vars, variable{Name: fmt.Sprintf("V%X", i), Value: fmt.Sprintf("0x%02x", v)})
+		}
+		vars = append(vars,
+			variable{Name: "I", Value: fmt.Sprintf("0x%04x", regs.I)},
+			variable{Name: "PC", Value: fmt.Sprintf("0x%04x", regs.PC)},
+			variable{Name: "SP", Value: fmt.Sprintf("0x%02x", regs.SP)},
+		)
+	case timersReference:
+		vars = append(vars,
+			variable{Name: "DT", Value: fmt.Sprintf("0x%02x", regs.DT)},
+			variable{Name: "ST", Value: fmt.Sprintf("0x%02x", regs.ST)},
+		)
+	}
+	return s.conn.respond(req, map[string]interface{}{"variables": vars})
+}
+
+// step responds to a stepping request and executes a single instruction,
+// or starts the stepping function when it is not nil
+func (s *Server) step(req *request, start func()) (bool, error) {
+	if err := s.conn.respond(req, nil); err != nil {
+		return false, err
+	}
+	if start != nil {
+		start()
+		return false, nil
+	}
+	result, err := s.cpu.Step(s.display, s.keyboard)
+	if err != nil {
+		return false, err
+	}
+	s.cpu.Render(s.display)
+	return s.stopped(result, "step")
+}
+
+// stepOver runs until the instruction after a CALL, or executes a single instruction otherwise
+func (s *Server) stepOver() {
+	regs := s.cpu.Registers()
+	in := s.cpu.InstructionAt(regs.PC)
+	next := regs.PC + in.Size()
+	depth := len(regs.Stack)
+	if in.Kind != chip8.OpCALL {
+		s.resume(func(r chip8.Registers) bool { return true }, "step")
+		return
+	}
+	s.resume(func(r chip8.Registers) bool { return r.PC == next && len(r.Stack) <= depth }, "step")
+}
+
+// resume runs the program until the function returns true, or freely when it is nil
+func (s *Server) resume(until func(regs chip8.Registers) bool, reason string) {
+	s.running = true
+	s.until = until
+	s.reason = reason
+}
+
+// stop pauses the program and notifies the client
+func (s *Server) stop(reason, description string) error {
+	s.running = false
+	s.until = nil
+	body := map[string]interface{}{"reason": reason, "threadId": threadID, "allThreadsStopped": true}
+	if description != "" {
+		body["description"] = description
+	}
+	return s.conn.notify("stopped", body)
+}
+
+// runFrame executes the instructions of one frame and reports whether the program ended
+func (s *Server) runFrame() (bool, error) {
+	s.cpu.Controller().RunActions()
+	for {
+		result, err := s.cpu.Step(s.display, s.keyboard)
+		if err != nil {
+			return false, err
+		}
+		if result.Reason != chip8.StopNone {
+			return s.stopped(result, s.reason)
+		}
+		if s.until != nil && s.until(s.cpu.Registers()) {
+			return false, s.stop(s.reason, "")
+		}
+		if result.Frames > 0 {
+			return false, nil
+		}
+	}
+}
+
+// stopped notifies the client about the result of executing instructions
+func (s *Server) stopped(result chip8.Result, reason string) (bool, error) {
+	switch result.Reason {
+	case chip8.StopExit, chip8.StopQuit:
+		s.running = false
+		if err := s.conn.notify("exited", map[string]interface{}{"exitCode": 0}); err != nil {
+			return true, err
+		}
+		return true, s.conn.notify("terminated", nil)
+	case chip8.StopBreak:
+		if result.Hit.Breakpoint.Type == chip8.BreakPC {
+			return false, s.stop("breakpoint", result.Hit.Error())
+		}
+		return false, s.stop("data breakpoint", result.Hit.Error())
+	}
+	return false, s.stop(reason, "")
+}
@@ -0,0 +1,182 @@
+package dap
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	goio "io"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/arjenvanderende/chip8/chip8"
+	"github.com/arjenvanderende/chip8/io/headless"
+)
+
+// client sends requests to a server over pipes and receives the messages it sends back
+type client struct {
+	t        *testing.T
+	w        goio.Writer
+	messages chan message
+	seq      int
+}
+
+// message contains the fields of responses and events that the tests check
+type message struct {
+	Type    string          `json:"type"`
+	Command string          `json:"command"`
+	Event   string          `json:"event"`
+	Success bool            `json:"success"`
+	Body    json.RawMessage `json:"body"`
+}
+
+func (c *client) send(command string, arguments interface{}) {
+	c.seq++
+	data, err := json.Marshal(map[string]interface{}{"seq": c.seq, "type": "request", "command": command, "arguments": arguments})
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	if _, err := fmt.Fprintf(c.w, "Content-Length: %d\r\n\r\n%s", len(data), data); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+// receive reads the messages of the server until the pipe is closed
+func receive(r *bufio.Reader, messages chan<- message) {
+	defer close(messages)
+	for {
+		msg, err := readMessage(r)
+		if err != nil {
+			return
+		}
+		messages <- msg
+	}
+}
+
+func readMessage(r *bufio.Reader) (message, error) {
+	var msg message
+	length := -1
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return msg, err
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			break
+		}
+		if strings.HasPrefix(line, "Content-Length:") {
+			length, _ = strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, "Content-Length:")))
+		}
+	}
+	body := make([]byte, length)
+	if _, err := goio.ReadFull(r, body); err != nil {
+		return msg, err
+	}
+	err := json.Unmarshal(body, &msg)
+	return msg, err
+}
+
+func (c *client) read() message {
+	select {
+	case msg, ok := <-c.messages:
+		if !ok {
+			c.t.Fatal("Server closed the connection")
+		}
+		return msg
+	case <-time.After(5 * time.Second):
+		c.t.Fatal("Timed out waiting for the server")
+	}
+	return message{}
+}
+
+// expect reads the next message and fails unless it is the response to the command or the event
+func (c *client) expect(kind, name string) message {
+	msg := c.read()
+	if msg.Type != kind || (msg.Command != name && msg.Event != name) {
+		c.t.Fatalf("Received %s %s%s, expected %s %s", msg.Type, msg.Command, msg.Event, kind, name)
+	}
+	if kind == "response" && !msg.Success {
+		c.t.Fatalf("Request %s failed: %s", name, msg.Body)
+	}
+	return msg
+}
+
+// startServer serves a program that exits immediately
+func startServer(t *testing.T) (*client, func()) {
+	cpu, err := chip8.LoadBytes([]byte{0x00, 0xfd}, chip8.Quirks{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyboard, err := headless.NewKeyboard(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := NewServer(cpu, nil, headless.NewDisplay(), keyboard)
+
+	requests, toServer := goio.Pipe()
+	fromServer, responses := goio.Pipe()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- server.Serve(ctx, requests, responses)
+		responses.Close()
+	}()
+	messages := make(chan message, 16)
+	go receive(bufio.NewReader(fromServer), messages)
+	stop := func() {
+		cancel()
+		toServer.Close()
+		fromServer.Close()
+		<-done
+	}
+	return &client{t: t, w: toServer, messages: messages}, stop
+}
+
+func TestProgramStartsAfterConfigurationDone(t *testing.T) {
+	c, stop := startServer(t)
+	defer stop()
+
+	c.send("initialize", nil)
+	c.expect("response", "initialize")
+	c.send("attach", nil)
+	c.expect("response", "attach")
+	c.expect("event", "initialized")
+
+	// the program has not started, so it answers requests instead of exiting
+	for i := 0; i < 5; i++ {
+		c.send("threads", nil)
+		c.expect("response", "threads")
+	}
+
+	c.send("configurationDone", nil)
+	c.expect("response", "configurationDone")
+	c.expect("event", "exited")
+	c.expect("event", "terminated")
+}
+
+func TestStopOnEntryAfterConfigurationDone(t *testing.T) {
+	c, stop := startServer(t)
+	defer stop()
+
+	c.send("initialize", nil)
+	c.expect("response", "initialize")
+	c.send("attach", map[string]interface{}{"stopOnEntry": true})
+	c.expect("response", "attach")
+	c.expect("event", "initialized")
+	c.send("configurationDone", nil)
+	c.expect("response", "configurationDone")
+
+	msg := c.expect("event", "stopped")
+	var body struct {
+		Reason string `json:"reason"`
+	}
+	if err := json.Unmarshal(msg.Body, &body); err != nil {
+		t.Fatal(err)
+	}
+	if body.Reason != "entry" {
+		t.Errorf("Stopped with reason %q, expected entry", body.Reason)
+	}
+}
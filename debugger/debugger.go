@@ -0,0 +1,341 @@
+package debugger
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/arjenvanderende/chip8/chip8"
+	"github.com/arjenvanderende/chip8/io"
+	"github.com/arjenvanderende/chip8/io/termbox"
+	tb "github.com/nsf/termbox-go"
+)
+
+const (
+	// frameRate represents the number of times per second that the debugger runs a frame and redraws its panes
+	frameRate = 60
+	// registersWidth represents the width of the registers and stack panes in cells
+	registersWidth = 26
+	// disassemblyWidth represents the width of the disassembly pane in cells
+	disassemblyWidth = 44
+	// disassemblyLines represents the minimum number of lines of the disassembly pane
+	disassemblyLines = 24
+	// memoryLines represents the number of lines of the memory pane, each showing 16 bytes
+	memoryLines = 8
+	// noTarget indicates that the debugger does not run to an address
+	noTarget = -1
+)
+
+type command int
+
+const (
+	cmdContinue command = iota
+	cmdStep
+	cmdStepOver
+	cmdRunToCursor
+	cmdCursorUp
+	cmdCursorDown
+	cmdMemoryUp
+	cmdMemoryDown
+	cmdMemoryFollow
+	cmdToggleBreakpoint
+)
+
+// Debugger runs a program step by step in the terminal, while showing the display,
+// the disassembly around the PC, the registers, the call stack and the memory
+type Debugger struct {
+	cpu      *chip8.CPU
+	display  io.Display
+	keyboard io.Keyboard
+	commands chan command
+
+	running      bool
+	target       int // address to run to, noTarget when not running to an address
+	targetDepth  int // maximum stack depth at which the target is reached
+	cursor       int // address of the cursor in the disassembly pane
+	memoryAddr   int // address of the first byte in the memory pane
+	memoryFollow bool
+	breakpoints  map[int]int // IDs of the PC breakpoints by address
+	hit          *chip8.Hit  // the breakpoint that paused the program
+}
+
+// New creates a debugger for the program loaded into the CPU, starting in paused state
+func New(cpu *chip8.CPU) *Debugger {
+	return &Debugger{
+		cpu:          cpu,
+		commands:     make(chan command, 16),
+		target:       noTarget,
+		cursor:       cpu.Registers().PC,
+		memoryFollow: true,
+		breakpoints:  make(map[int]int),
+	}
+}
+
+// Hotkeys returns the keys that control the debugger. They must be passed to termbox.New() as part of its options.
+// The function keys F1-F8 are left to the save state hotkeys.
+func (d *Debugger) Hotkeys() termbox.Hotkeys {
+	send := func(cmd command) func() {
+		return func() {
+			d.commands <- cmd
+		}
+	}
+	return termbox.Hotkeys{
+		termbox.FunctionKey(9):  send(cmdContinue),
+		{Ch: 'g'}:               send(cmdContinue),
+		{Ch: 'p'}:               send(cmdContinue),
+		termbox.FunctionKey(10): send(cmdStepOver),
+		{Ch: 'o'}:               send(cmdStepOver),
+		termbox.FunctionKey(11): send(cmdStep),
+		{Ch: 'i'}:               send(cmdStep),
+		{Ch: 'n'}:               send(cmdStep),
+		termbox.FunctionKey(12): send(cmdRunToCursor),
+		{Ch: 'h'}:               send(cmdRunToCursor),
+		{Key: tb.KeyArrowUp}:    send(cmdCursorUp),
+		{Key: tb.KeyArrowDown}:  send(cmdCursorDown),
+		{Key: tb.KeyPgup}:       send(cmdMemoryUp),
+		{Key: tb.KeyPgdn}:       send(cmdMemoryDown),
+		{Key: tb.KeyHome}:       send(cmdMemoryFollow),
+		{Key: tb.KeyInsert}:     send(cmdToggleBreakpoint),
+		{Ch: 't'}:               send(cmdToggleBreakpoint),
+	}
+}
+
+// Run debugs the program until it exits, the user quits or the context is cancelled
+func (d *Debugger) Run(ctx context.Context, display io.Display, keyboard io.Keyboard) error {
+	d.display = display
+	d.keyboard = keyboard
+
+	frame := time.NewTicker(time.Second / time.Duration(frameRate))
+	defer frame.Stop()
+
+	d.render()
+	for {
+		var result chip8.Result
+		var err error
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case cmd := <-d.commands:
+			result, err = d.execute(cmd)
+		case <-frame.C:
+			result, err = d.frame()
+		}
+		if result.Reason == chip8.StopBreak {
+			d.pause(result.Hit)
+		} else if result.Reason != chip8.StopNone || err != nil {
+			return err
+		}
+		d.render()
+	}
+}
+
+func (d *Debugger) execute(cmd command) (chip8.Result, error) {
+	regs := d.cpu.Registers()
+	d.hit = nil
+	switch cmd {
+	case cmdContinue:
+		d.running = !d.running
+		d.target = noTarget
+		d.cursor = regs.PC
+	case cmdStep:
+		d.running = false
+		d.target = noTarget
+		result, err := d.cpu.Step(d.display, d.keyboard)
+		d.cursor = d.cpu.Registers().PC
+		return result, err
+	case cmdStepOver:
+		in := d.cpu.InstructionAt(regs.PC)
+		if in.Kind != chip8.OpCALL {
+			return d.execute(cmdStep)
+		}
+		d.runTo(regs.PC+in.Size(), len(regs.Stack))
+	case cmdRunToCursor:
+		d.runTo(d.cursor, len(regs.Stack)+16)
+	case cmdCursorUp:
+		// the instruction before the cursor is either 4 bytes long (F000 NNNN) or 2 bytes
+		if d.cursor >= 4 && d.cpu.InstructionAt(d.cursor-4).Size() == 4 {
+			d.cursor -= 4
+		} else if d.cursor >= 2 {
+			d.cursor -= 2
+		}
+	case cmdCursorDown:
+		d.cursor += d.cpu.InstructionAt(d.cursor).Size()
+	case cmdMemoryUp:
+		d.memoryFollow = false
+		d.memoryAddr -= memoryLines * 16
+	case cmdMemoryDown:
+		d.memoryFollow = false
+		d.memoryAddr += memoryLines * 16
+	case cmdMemoryFollow:
+		d.memoryFollow = true
+	case cmdToggleBreakpoint:
+		if id, ok := d.breakpoints[d.cursor]; ok {
+			d.cpu.RemoveBreakpoint(id)
+			delete(d.breakpoints, d.cursor)
+		} else {
+			id, err := d.cpu.AddBreakpoint(chip8.Breakpoint{Type: chip8.BreakPC, Start: d.cursor})
+			if err != nil {
+				return chip8.Result{}, err
+			}
+			d.breakpoints[d.cursor] = id
+		}
+	}
+	return chip8.Result{}, nil
+}
+
+// pause stops running because the breakpoint was triggered
+func (d *Debugger) pause(hit *chip8.Hit) {
+	d.running = false
+	d.target = noTarget
+	d.cursor = d.cpu.Registers().PC
+	d.hit = hit
+}
+
+// runTo continues running until the PC reaches the address with at most depth return addresses on the stack
+func (d *Debugger) runTo(addr, depth int) {
+	d.running = true
+	d.target = addr
+	d.targetDepth = depth
+}
+
+// frame handles the actions of the controller and runs the program for a frame when it is running.
+// The user can quit with ESC, also while the program is paused.
+func (d *Debugger) frame() (chip8.Result, error) {
+	d.cpu.Controller().RunActions()
+	if d.keyboard.IsPressed(io.KeyEsc) {
+		return chip8.Result{Reason: chip8.StopQuit}, nil
+	}
+	if !d.running {
+		return chip8.Result{}, nil
+	}
+	return d.runFrame()
+}
+
+// runFrame executes the instructions of one frame, stopping early when the target is reached
+func (d *Debugger) runFrame() (chip8.Result, error) {
+	for {
+		result, err := d.cpu.Step(d.display, d.keyboard)
+		if result.Reason != chip8.StopNone || err != nil {
+			return result, err
+		}
+
+		regs := d.cpu.Registers()
+		if d.target != noTarget && regs.PC == d.target && len(regs.Stack) <= d.targetDepth {
+			d.pause(nil)
+			return result, nil
+		}
+		if result.Frames > 0 {
+			return result, nil
+		}
+	}
+}
+
+// render draws the panes next to and below the display
+func (d *Debugger) render() {
+	regs := d.cpu.Registers()
+	width, height := termbox.Size(d.display, d.cpu.Framebuffer().Resolution)
+	x := width + 2
+	if d.memoryFollow {
+		d.memoryAddr = int(regs.I) &^ 0xf
+	}
+
+	d.renderRegisters(x, 0, regs)
+	d.renderStack(x, 8, regs)
+	lines := disassemblyLines
+	if height > lines {
+		lines = height
+	}
+	d.renderDisassembly(x+registersWidth, 0, lines, regs)
+	d.renderMemory(0, height+1)
+	d.renderStatus(0, height+memoryLines+2)
+	tb.Flush()
+}
+
+func (d *Debugger) renderRegisters(x, y int, regs chip8.Registers) {
+	for row := 0; row < 4; row++ {
+		line := ""
+		for col := 0; col < 4; col++ {
+			r := row*4 + col
+			line += fmt.Sprintf("V%X %02x  ", r, regs.V[r])
+		}
+		drawText(x, y+row, registersWidth, line, tb.ColorDefault)
+	}
+	drawText(x, y+4, registersWidth, fmt.Sprintf("PC %04x  I %04x  SP %02x", regs.PC, regs.I, regs.SP), tb.ColorDefault)
+	drawText(x, y+5, registersWidth, fmt.Sprintf("DT %02x    ST %02x", regs.DT, regs.ST), tb.ColorDefault)
+}
+
+func (d *Debugger) renderStack(x, y int, regs chip8.Registers) {
+	drawText(x, y, registersWidth, "Call stack", tb.ColorYellow)
+	for i := 0; i < 16; i++ {
+		line := ""
+		if i < len(regs.Stack) {
+			// show the most recent call first
+			line = fmt.Sprintf("%2d %04x", i, regs.Stack[len(regs.Stack)-1-i])
+		}
+		drawText(x, y+1+i, registersWidth, line, tb.ColorDefault)
+	}
+}
+
+func (d *Debugger) renderDisassembly(x, y, lines int, regs chip8.Registers) {
+	drawText(x, y, disassemblyWidth, "Disassembly", tb.ColorYellow)
+	addr := d.cursor - 2*((lines-1)/2)
+	if addr < 0 {
+		addr = d.cursor % 2
+	}
+	for i := 1; i < lines; i++ {
+		marker := "  "
+		if addr == regs.PC {
+			marker = "> "
+		}
+		if _, ok := d.breakpoints[addr]; ok {
+			marker = marker[:1] + "*"
+		}
+		color := tb.ColorDefault
+		if addr == d.cursor {
+			color = tb.ColorCyan
+		}
+		drawText(x, y+i, disassemblyWidth, marker+d.cpu.DisassembleAt(addr), color)
+		addr += d.cpu.InstructionAt(addr).Size()
+	}
+}
+
+func (d *Debugger) renderMemory(x, y int) {
+	for row := 0; row < memoryLines; row++ {
+		addr := (d.memoryAddr + row*16) & 0xffff
+		line := fmt.Sprintf("%04x:", addr)
+		for _, b := range d.cpu.ReadMemory(addr, 16) {
+			line += fmt.Sprintf(" %02x", b)
+		}
+		drawText(x, y+row, len(line), line, tb.ColorDefault)
+	}
+}
+
+func (d *Debugger) renderStatus(x, y int) {
+	status := "PAUSED "
+	if d.running {
+		status = "RUNNING"
+	}
+	help := " g/F9 continue  i/F11 step  o/F10 step over  h/F12 run to cursor  t/ins breakpoint  up/down cursor  pgup/pgdn/home memory  esc quit"
+	drawText(x, y, len(status)+len(help), status+help, tb.ColorDefault)
+
+	hit := ""
+	if d.hit != nil {
+		hit = d.hit.Error()
+	}
+	drawText(x, y+1, len(help), hit, tb.ColorRed)
+}
+
+// drawText writes the text at the position, padding it with spaces to the width
+func drawText(x, y, width int, text string, fg tb.Attribute) {
+	i := 0
+	for _, ch := range text {
+		if i >= width {
+			return
+		}
+		tb.SetCell(x+i, y, ch, fg, tb.ColorDefault)
+		i++
+	}
+	for ; i < width; i++ {
+		tb.SetCell(x+i, y, ' ', tb.ColorDefault, tb.ColorDefault)
+	}
+}
@@ -0,0 +1,162 @@
+package debugger
+
+import (
+	"testing"
+
+	"github.com/arjenvanderende/chip8/chip8"
+	"github.com/arjenvanderende/chip8/io"
+	"github.com/arjenvanderende/chip8/io/headless"
+	"github.com/arjenvanderende/chip8/io/termbox"
+)
+
+// program calls a subroutine and contains a 4-byte instruction
+var program = []byte{
+	0x22, 0x0a, // 200: CALL 20A
+	0xf0, 0x00, 0x03, 0x00, // 202: LD I, LONG 0300
+	0x60, 0x01, // 206: LD V0, 01
+	0x12, 0x08, // 208: JP 208
+	0x61, 0x02, // 20A: LD V1, 02
+	0x00, 0xee, // 20C: RET
+}
+
+// keyboard presses ESC when quit is set
+type keyboard struct {
+	quit bool
+}
+
+func (k *keyboard) Tick() {}
+
+func (k *keyboard) IsPressed(key io.Key) bool {
+	return k.quit && key == io.KeyEsc
+}
+
+func (k *keyboard) PressedButton() *io.Key {
+	return nil
+}
+
+func newTestDebugger(t *testing.T) (*Debugger, *keyboard) {
+	cpu, err := chip8.LoadBytes(program, chip8.Quirks{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := New(cpu)
+	k := &keyboard{}
+	d.display = headless.NewDisplay()
+	d.keyboard = k
+	return d, k
+}
+
+func mustExecute(t *testing.T, d *Debugger, cmd command) {
+	if _, err := d.execute(cmd); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// runFrames runs frames until the debugger pauses, and returns the result of the last frame
+func runFrames(t *testing.T, d *Debugger, frames int) chip8.Result {
+	for f := 0; f < frames; f++ {
+		result, err := d.frame()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.Reason == chip8.StopBreak {
+			d.pause(result.Hit)
+		}
+		if result.Reason != chip8.StopNone || !d.running {
+			return result
+		}
+	}
+	return chip8.Result{}
+}
+
+func TestHotkeysLeaveSaveStateKeys(t *testing.T) {
+	d, _ := newTestDebugger(t)
+	hotkeys := d.Hotkeys()
+	for n := 1; n <= 8; n++ {
+		if _, ok := hotkeys[termbox.FunctionKey(n)]; ok {
+			t.Errorf("Debugger uses F%d, which saves or loads a state", n)
+		}
+	}
+
+	hotkeys[termbox.Hotkey{Ch: 't'}]()
+	if cmd := <-d.commands; cmd != cmdToggleBreakpoint {
+		t.Errorf("Hotkey t sent command %d, expected %d", cmd, cmdToggleBreakpoint)
+	}
+}
+
+func TestCursorMovesByInstruction(t *testing.T) {
+	d, _ := newTestDebugger(t)
+	for _, test := range []struct {
+		cmd    command
+		cursor int
+	}{
+		{cmdCursorDown, 0x202},
+		{cmdCursorDown, 0x206},
+		{cmdCursorDown, 0x208},
+		{cmdCursorUp, 0x206},
+		{cmdCursorUp, 0x202},
+		{cmdCursorUp, 0x200},
+	} {
+		mustExecute(t, d, test.cmd)
+		if d.cursor != test.cursor {
+			t.Fatalf("Command %d moved the cursor to %03x, expected %03x", test.cmd, d.cursor, test.cursor)
+		}
+	}
+}
+
+func TestStep(t *testing.T) {
+	d, _ := newTestDebugger(t)
+	mustExecute(t, d, cmdStep)
+	if regs := d.cpu.Registers(); regs.PC != 0x20a || len(regs.Stack) != 1 || d.cursor != 0x20a {
+		t.Errorf("Step stopped at %03x with %d return addresses and the cursor at %03x, expected the subroutine", regs.PC, len(regs.Stack), d.cursor)
+	}
+}
+
+func TestStepOver(t *testing.T) {
+	d, _ := newTestDebugger(t)
+	mustExecute(t, d, cmdStepOver)
+	runFrames(t, d, 10)
+	regs := d.cpu.Registers()
+	if d.running || regs.PC != 0x202 || regs.V[1] != 2 {
+		t.Errorf("Step over stopped at %03x with V1=%d, expected 202 after running the subroutine", regs.PC, regs.V[1])
+	}
+}
+
+func TestRunToCursor(t *testing.T) {
+	d, _ := newTestDebugger(t)
+	d.cursor = 0x206
+	mustExecute(t, d, cmdRunToCursor)
+	runFrames(t, d, 10)
+	if pc := d.cpu.Registers().PC; d.running || pc != 0x206 {
+		t.Errorf("Run to cursor stopped at %03x, expected 206", pc)
+	}
+}
+
+func TestToggleBreakpoint(t *testing.T) {
+	d, _ := newTestDebugger(t)
+	d.cursor = 0x20c
+	mustExecute(t, d, cmdToggleBreakpoint)
+	mustExecute(t, d, cmdContinue)
+	result := runFrames(t, d, 10)
+	if result.Reason != chip8.StopBreak || d.running || d.cpu.Registers().PC != 0x20c {
+		t.Fatalf("Continue stopped at %03x (%v), expected the breakpoint at 20C", d.cpu.Registers().PC, result.Reason)
+	}
+
+	// removing the breakpoint runs the program until it loops
+	mustExecute(t, d, cmdToggleBreakpoint)
+	mustExecute(t, d, cmdContinue)
+	if result := runFrames(t, d, 3); result.Reason != chip8.StopNone || !d.running {
+		t.Errorf("Program stopped (%v) after removing the breakpoint", result.Reason)
+	}
+}
+
+func TestQuitWhilePaused(t *testing.T) {
+	d, k := newTestDebugger(t)
+	if result, err := d.frame(); err != nil || result.Reason != chip8.StopNone {
+		t.Fatalf("Paused frame = %v, %v, expected nothing to happen", result.Reason, err)
+	}
+	k.quit = true
+	if result, err := d.frame(); err != nil || result.Reason != chip8.StopQuit {
+		t.Errorf("Paused frame with ESC pressed = %v, %v, expected to quit", result.Reason, err)
+	}
+}
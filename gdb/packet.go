@@ -0,0 +1,105 @@
+package gdb
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// interrupt represents the byte that the client sends to stop a running program
+const interrupt = 0x03
+
+// event represents a packet or an interrupt that was received from the client
+type event struct {
+	packet    string
+	interrupt bool
+	err       error
+}
+
+// readEvents reads packets and interrupts from the client until the connection fails.
+// Every packet is acknowledged, unless the client switched to no-ack mode. Packets with
+// an invalid checksum are rejected with '-', so that the client sends them again.
+func readEvents(r *bufio.Reader, w io.Writer, ack func() bool, events chan<- event) {
+	defer close(events)
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			events <- event{err: err}
+			return
+		}
+		switch b {
+		case interrupt:
+			events <- event{interrupt: true}
+		case '$':
+			packet, valid, err := readPacket(r)
+			if err != nil {
+				events <- event{err: err}
+				return
+			}
+			if ack() {
+				reply := byte('+')
+				if !valid {
+					reply = '-'
+				}
+				if _, err := w.Write([]byte{reply}); err != nil {
+					events <- event{err: err}
+					return
+				}
+				if !valid {
+					continue
+				}
+			}
+			events <- event{packet: packet}
+		default:
+			// ignore acknowledgements of our own packets
+		}
+	}
+}
+
+// readPacket reads the data and checksum of a packet, after its leading '$', and reports
+// whether the checksum matches the data. The checksum is not verified in no-ack mode,
+// because the client does not send the packet again.
+func readPacket(r *bufio.Reader) (string, bool, error) {
+	data, err := r.ReadString('#')
+	if err != nil {
+		return "", false, err
+	}
+	data = data[:len(data)-1]
+	checksum := make([]byte, 2)
+	if _, err := io.ReadFull(r, checksum); err != nil {
+		return "", false, err
+	}
+	sum, err := strconv.ParseUint(string(checksum), 16, 8)
+	valid := err == nil && byte(sum) == checksumOf(data)
+	return unescape(data), valid, nil
+}
+
+// checksumOf returns the sum of the bytes of the data, modulo 256
+func checksumOf(data string) byte {
+	var sum byte
+	for i := 0; i < len(data); i++ {
+		sum += data[i]
+	}
+	return sum
+}
+
+// unescape removes the escaping of '#', '$', '}' and '*' from binary data
+func unescape(data string) string {
+	b := make([]byte, 0, len(data))
+	for i := 0; i < len(data); i++ {
+		if data[i] == '}' && i+1 < len(data) {
+			i++
+			b = append(b, data[i]^0x20)
+		} else {
+			b = append(b, data[i])
+		}
+	}
+	return string(b)
+}
+
+// writePacket sends the data to the client, framed by '$' and its checksum
+func writePacket(w io.Writer, data string) error {
+	_, err := fmt.Fprintf(w, "$%s#%02x", data, checksumOf(data))
+	return err
+}
@@ -0,0 +1,486 @@
+// Package gdb serves the GDB Remote Serial Protocol, so that remote debugging clients
+// can inspect and control a running program.
+//
+// The registers are numbered V0-VF (0-15, 8 bits), I (16, 16 bits), PC (17, 16 bits),
+// SP (18, 8 bits), DT (19, 8 bits) and ST (20, 8 bits), and are transferred in
+// big-endian byte order like the memory of the Chip-8. The layout is also described
+// by the target.xml document that clients can request.
+package gdb
+
+import (
+	"bufio"
+	"context"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/arjenvanderende/chip8/chip8"
+	"github.com/arjenvanderende/chip8/io"
+)
+
+const (
+	// frameRate represents the number of frames per second that a continued program runs
+	frameRate = 60
+	// registerCount represents the number of registers that are exposed to the client
+	registerCount = 21
+)
+
+// targetXML describes the registers of the Chip-8 to the client
+const targetXML = `<?xml version="1.0"?>
+<!DOCTYPE target SYSTEM "gdb-target.dtd">
+<target version="1.0">
+  <feature name="org.chip8.core">
+    <reg name="v0" bitsize="8" regnum="0"/>
+    <reg name="v1" bitsize="8"/>
+    <reg name="v2" bitsize="8"/>
+    <reg name="v3" bitsize="8"/>
+    <reg name="v4" bitsize="8"/>
+    <reg name="v5" bitsize="8"/>
+    <reg name="v6" bitsize="8"/>
+    <reg name="v7" bitsize="8"/>
+    <reg name="v8" bitsize="8"/>
+    <reg name="v9" bitsize="8"/>
+    <reg name="va" bitsize="8"/>
+    <reg name="vb" bitsize="8"/>
+    <reg name="vc" bitsize="8"/>
+    <reg name="vd" bitsize="8"/>
+    <reg name="ve" bitsize="8"/>
+    <reg name="vf" bitsize="8"/>
+    <reg name="i" bitsize="16" type="data_ptr"/>
+    <reg name="pc" bitsize="16" type="code_ptr"/>
+    <reg name="sp" bitsize="8"/>
+    <reg name="dt" bitsize="8"/>
+    <reg name="st" bitsize="8"/>
+  </feature>
+</target>
+`
+
+// breakpointKey identifies a breakpoint that was inserted by the client
+type breakpointKey struct {
+	kind byte // the type of the Z packet
+	addr int
+}
+
+// Server controls a CPU on behalf of a remote debugging client
+type Server struct {
+	cpu         *chip8.CPU
+	display     io.Display
+	keyboard    io.Keyboard
+	breakpoints map[breakpointKey]int // IDs of the breakpoints inserted by the client
+	noAck       bool
+}
+
+// NewServer creates a server for the program loaded into the CPU
+func NewServer(cpu *chip8.CPU, display io.Display, keyboard io.Keyboard) *Server {
+	return &Server{
+		cpu:         cpu,
+		display:     display,
+		keyboard:    keyboard,
+		breakpoints: make(map[breakpointKey]int),
+	}
+}
+
+// ListenAndServe waits for a client on the TCP address and serves it until it detaches,
+// the program exits or the context is cancelled. Addresses without a host, like ":1234",
+// only listen on localhost.
+func (s *Server) ListenAndServe(ctx context.Context, addr string) error {
+	if strings.HasPrefix(addr, ":") {
+		addr = "localhost" + addr
+	}
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("Unable to listen for GDB clients: %v", err)
+	}
+	defer listener.Close()
+
+	// stop waiting for a client when the context is cancelled
+	go func() {
+		<-ctx.Done()
+		listener.Close()
+	}()
+
+	log.Printf("Waiting for GDB client on %s\n", listener.Addr())
+	conn, err := listener.Accept()
+	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return fmt.Errorf("Unable to accept GDB client: %v", err)
+	}
+	defer conn.Close()
+
+	return s.Serve(ctx, conn)
+}
+
+// Serve handles the packets of the client on the connection and closes it when done
+func (s *Server) Serve(ctx context.Context, conn net.Conn) error {
+	events := make(chan event)
+	go readEvents(bufio.NewReader(conn), conn, func() bool { return !s.noAck }, events)
+	defer func() {
+		// stop the reader and discard the events that it still sends
+		conn.Close()
+		go func() {
+			for range events {
+			}
+		}()
+	}()
+
+	// unblock the reader when the context is cancelled
+	go func() {
+		<-ctx.Done()
+		conn.Close()
+	}()
+
+	for e := range events {
+		if e.err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return nil
+		}
+		if e.interrupt {
+			// the program is not running, so report that it is stopped
+			if err := writePacket(conn, "S02"); err != nil {
+				return err
+			}
+			continue
+		}
+
+		reply, done, err := s.handle(e.packet, events)
+		if err != nil {
+			return err
+		}
+		if err := writePacket(conn, reply); err != nil {
+			return err
+		}
+		if done {
+			return nil
+		}
+	}
+	return nil
+}
+
+// handle executes the packet and returns the reply, and whether the session has ended
+func (s *Server) handle(packet string, events <-chan event) (string, bool, error) {
+	if packet == "" {
+		return "", false, nil
+	}
+	args := packet[1:]
+	switch packet[0] {
+	case '?':
+		return "S05", false, nil
+	case 'g':
+		return s.readRegisters(), false, nil
+	case 'G':
+		return s.writeRegisters(args), false, nil
+	case 'p':
+		n, err := strconv.ParseUint(args, 16, 8)
+		if err != nil || n >= registerCount {
+			return "E01", false, nil
+		}
+		return s.readRegister(int(n)), false, nil
+	case 'P':
+		return s.writeRegister(args), false, nil
+	case 'm':
+		return s.readMemory(args), false, nil
+	case 'M':
+		return s.writeMemory(args), false, nil
+	case 's', 'c':
+		// the optional argument is the address to continue at
+		if args != "" {
+			addr, err := strconv.ParseUint(args, 16, 16)
+			if err != nil {
+				return "E01", false, nil
+			}
+			regs := s.cpu.Registers()
+			regs.PC = int(addr)
+			s.cpu.SetRegisters(regs)
+		}
+		if packet[0] == 's' {
+			return s.step()
+		}
+		return s.resume(events)
+	case 'Z', 'z':
+		return s.breakpoint(packet[0] == 'Z', args), false, nil
+	case 'k':
+		return "", true, nil
+	case 'D':
+		return "OK", true, nil
+	case 'H':
+		return "OK", false, nil
+	case 'q', 'Q':
+		return s.query(packet), false, nil
+	}
+	return "", false, nil
+}
+
+func (s *Server) query(packet string) string {
+	switch {
+	case strings.HasPrefix(packet, "qSupported"):
+		return "PacketSize=4000;qXfer:features:read+;QStartNoAckMode+"
+	case packet == "QStartNoAckMode":
+		s.noAck = true
+		return "OK"
+	case strings.HasPrefix(packet, "qXfer:features:read:target.xml:"):
+		return readXfer(targetXML, strings.TrimPrefix(packet, "qXfer:features:read:target.xml:"))
+	case packet == "qAttached":
+		return "1"
+	case packet == "qC":
+		return "QC1"
+	case packet == "qfThreadInfo":
+		return "m1"
+	case packet == "qsThreadInfo":
+		return "l"
+	}
+	return ""
+}
+
+// readXfer returns the part of the document that is requested by "offset,length"
+func readXfer(document, args string) string {
+	parts := strings.Split(args, ",")
+	if len(parts) != 2 {
+		return "E01"
+	}
+	offset, err1 := strconv.ParseUint(parts[0], 16, 32)
+	length, err2 := strconv.ParseUint(parts[1], 16, 32)
+	if err1 != nil || err2 != nil {
+		return "E01"
+	}
+	if int(offset) >= len(document) {
+		return "l"
+	}
+	end := int(offset + length)
+	if end >= len(document) {
+		return "l" + document[offset:]
+	}
+	return "m" + document[offset:end]
+}
+
+func (s *Server) readRegisters() string {
+	var b strings.Builder
+	for n := 0; n < registerCount; n++ {
+		b.WriteString(s.readRegister(n))
+	}
+	return b.String()
+}
+
+func (s *Server) readRegister(n int) string {
+	regs := s.cpu.Registers()
+	switch {
+	case n < 16:
+		return fmt.Sprintf("%02x", regs.V[n])
+	case n == 16:
+		return fmt.Sprintf("%04x", regs.I)
+	case n == 17:
+		return fmt.Sprintf("%04x", regs.PC)
+	case n == 18:
+		return fmt.Sprintf("%02x", regs.SP)
+	case n == 19:
+		return fmt.Sprintf("%02x", regs.DT)
+	}
+	return fmt.Sprintf("%02x", regs.ST)
+}
+
+// registerSize returns the number of hex digits of the register
+func registerSize(n int) int {
+	if n == 16 || n == 17 {
+		return 4
+	}
+	return 2
+}
+
+func (s *Server) writeRegisters(args string) string {
+	for n := 0; n < registerCount; n++ {
+		size := registerSize(n)
+		if len(args) < size {
+			return "E01"
+		}
+		if reply := s.writeRegister(fmt.Sprintf("%x=%s", n, args[:size])); reply != "OK" {
+			return reply
+		}
+		args = args[size:]
+	}
+	return "OK"
+}
+
+func (s *Server) writeRegister(args string) string {
+	parts := strings.Split(args, "=")
+	if len(parts) != 2 {
+		return "E01"
+	}
+	n, err1 := strconv.ParseUint(parts[0], 16, 8)
+	value, err2 := strconv.ParseUint(parts[1], 16, 16)
+	if err1 != nil || err2 != nil || n >= registerCount {
+		return "E01"
+	}
+
+	regs := s.cpu.Registers()
+	switch {
+	case n < 16:
+		regs.V[n] = byte(value)
+	case n == 16:
+		regs.I = uint16(value)
+	case n == 17:
+		regs.PC = int(value)
+	case n == 18:
+		if value > 16 {
+			return "E01"
+		}
+		// keep the return addresses that remain on the stack
+		stack := make([]int, value)
+		copy(stack, regs.Stack)
+		regs.Stack = stack
+	case n == 19:
+		regs.DT = byte(value)
+	default:
+		regs.ST = byte(value)
+	}
+	s.cpu.SetRegisters(regs)
+	return "OK"
+}
+
+// parseRange parses the "addr,length" arguments of memory packets
+func parseRange(args string) (int, int, bool) {
+	parts := strings.Split(args, ",")
+	if len(parts) != 2 {
+		return 0, 0, false
+	}
+	addr, err1 := strconv.ParseUint(parts[0], 16, 32)
+	length, err2 := strconv.ParseUint(parts[1], 16, 32)
+	if err1 != nil || err2 != nil || length > 0x10000 {
+		return 0, 0, false
+	}
+	return int(addr), int(length), true
+}
+
+func (s *Server) readMemory(args string) string {
+	addr, length, ok := parseRange(args)
+	if !ok {
+		return "E01"
+	}
+	return hex.EncodeToString(s.cpu.ReadMemory(addr, length))
+}
+
+func (s *Server) writeMemory(args string) string {
+	parts := strings.SplitN(args, ":", 2)
+	if len(parts) != 2 {
+		return "E01"
+	}
+	addr, length, ok := parseRange(parts[0])
+	data, err := hex.DecodeString(parts[1])
+	if !ok || err != nil || len(data) != length {
+		return "E01"
+	}
+	s.cpu.WriteMemory(addr, data)
+	return "OK"
+}
+
+// breakpoint inserts or removes a breakpoint for the "type,addr,kind" arguments
+func (s *Server) breakpoint(insert bool, args string) string {
+	parts := strings.Split(args, ",")
+	if len(parts) != 3 || len(parts[0]) != 1 {
+		return "E01"
+	}
+	addr, err := strconv.ParseUint(parts[1], 16, 16)
+	if err != nil {
+		return "E01"
+	}
+	length, err := strconv.ParseUint(parts[2], 16, 16)
+	if err != nil {
+		return "E01"
+	}
+
+	bp := chip8.Breakpoint{Start: int(addr)}
+	switch parts[0][0] {
+	case '0', '1':
+		bp.Type = chip8.BreakPC
+	case '2':
+		bp.Type = chip8.BreakWrite
+	case '3':
+		bp.Type = chip8.BreakRead
+	case '4':
+		bp.Type = chip8.BreakAccess
+	default:
+		return ""
+	}
+	if bp.Type != chip8.BreakPC && length > 0 {
+		bp.End = bp.Start + int(length) - 1
+	}
+
+	key := breakpointKey{kind: parts[0][0], addr: int(addr)}
+	if !insert {
+		if id, ok := s.breakpoints[key]; ok {
+			s.cpu.RemoveBreakpoint(id)
+			delete(s.breakpoints, key)
+		}
+		return "OK"
+	}
+	if _, ok := s.breakpoints[key]; ok {
+		return "OK"
+	}
+	id, err := s.cpu.AddBreakpoint(bp)
+	if err != nil {
+		return "E01"
+	}
+	s.breakpoints[key] = id
+	return "OK"
+}
+
+// step executes a single instruction
+func (s *Server) step() (string, bool, error) {
+	result, err := s.cpu.Step(s.display, s.keyboard)
+	if err != nil {
+		return "", false, err
+	}
+	s.cpu.Render(s.display)
+	return stopReply(result), result.Reason == chip8.StopExit || result.Reason == chip8.StopQuit, nil
+}
+
+// resume runs the program until a breakpoint is triggered, the program stops or the client interrupts
+func (s *Server) resume(events <-chan event) (string, bool, error) {
+	frame := time.NewTicker(time.Second / time.Duration(frameRate))
+	defer frame.Stop()
+
+	for {
+		select {
+		case e, ok := <-events:
+			if !ok || e.err != nil {
+				return "", true, nil
+			}
+			if e.interrupt {
+				return "S02", false, nil
+			}
+		case <-frame.C:
+			s.cpu.Controller().RunActions()
+			result, err := s.cpu.RunFrame(s.display, s.keyboard)
+			if err != nil {
+				return "", false, err
+			}
+			if result.Reason != chip8.StopNone {
+				return stopReply(result), result.Reason == chip8.StopExit || result.Reason == chip8.StopQuit, nil
+			}
+		}
+	}
+}
+
+// stopReply reports why the program stopped
+func stopReply(result chip8.Result) string {
+	switch result.Reason {
+	case chip8.StopExit, chip8.StopQuit:
+		return "W00"
+	case chip8.StopBreak:
+		switch result.Hit.Breakpoint.Type {
+		case chip8.BreakWrite:
+			return fmt.Sprintf("T05watch:%x;", result.Hit.Addr)
+		case chip8.BreakRead:
+			return fmt.Sprintf("T05rwatch:%x;", result.Hit.Addr)
+		case chip8.BreakAccess:
+			return fmt.Sprintf("T05awatch:%x;", result.Hit.Addr)
+		}
+	}
+	return "S05"
+}
@@ -0,0 +1,169 @@
+package gdb
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/arjenvanderende/chip8/chip8"
+	"github.com/arjenvanderende/chip8/io/headless"
+)
+
+// program counts in V0 until it is continued at the exit
+var program = []byte{
+	0x60, 0x01, // 200: LD V0, 01
+	0x61, 0x02, // 202: LD V1, 02
+	0x70, 0x01, // 204: ADD V0, 01
+	0x12, 0x04, // 206: JP 204
+	0x00, 0xfd, // 208: EXIT
+}
+
+// client sends packets to a server over a pipe and reads its replies
+type client struct {
+	t    *testing.T
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+func startServer(t *testing.T) (*client, func()) {
+	cpu, err := chip8.LoadBytes(program, chip8.Quirks{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyboard, err := headless.NewKeyboard(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := NewServer(cpu, headless.NewDisplay(), keyboard)
+
+	conn, serverConn := net.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		done <- server.Serve(context.Background(), serverConn)
+	}()
+	stop := func() {
+		conn.Close()
+		if err := <-done; err != nil {
+			t.Error(err)
+		}
+	}
+	return &client{t: t, conn: conn, r: bufio.NewReader(conn)}, stop
+}
+
+// write sends the raw bytes to the server
+func (c *client) write(data string) {
+	c.conn.SetDeadline(time.Now().Add(5 * time.Second))
+	if _, err := c.conn.Write([]byte(data)); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+// readByte reads the next byte from the server
+func (c *client) readByte() byte {
+	c.conn.SetDeadline(time.Now().Add(5 * time.Second))
+	b, err := c.r.ReadByte()
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	return b
+}
+
+// send sends the packet and returns the reply of the server
+func (c *client) send(packet string) string {
+	c.write(fmt.Sprintf("$%s#%02x", packet, checksumOf(packet)))
+	if ack := c.readByte(); ack != '+' {
+		c.t.Fatalf("Packet %s was acknowledged with %q", packet, ack)
+	}
+	if b := c.readByte(); b != '$' {
+		c.t.Fatalf("Reply to %s starts with %q", packet, b)
+	}
+	c.conn.SetDeadline(time.Now().Add(5 * time.Second))
+	reply, err := c.r.ReadString('#')
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	c.readByte()
+	c.readByte()
+	c.write("+")
+	return strings.TrimSuffix(reply, "#")
+}
+
+// expect sends the packet and fails unless the server replies with the expected data
+func (c *client) expect(packet, reply string) {
+	if r := c.send(packet); r != reply {
+		c.t.Errorf("Reply to %s = %q, expected %q", packet, r, reply)
+	}
+}
+
+// registers returns the reply to g for the registers V0-VF, I, PC and SP, DT and ST of zero
+func registers(v string, i, pc int) string {
+	return v + strings.Repeat("00", 16-len(v)/2) + fmt.Sprintf("%04x%04x", i, pc) + "000000"
+}
+
+func TestRegisters(t *testing.T) {
+	c, stop := startServer(t)
+	defer stop()
+
+	c.expect("g", registers("", 0, 0x200))
+	c.expect("G"+registers("0102", 0x300, 0x204), "OK")
+	c.expect("g", registers("0102", 0x300, 0x204))
+	c.expect("p11", "0204")
+	c.expect("P0=ff", "OK")
+	c.expect("p0", "ff")
+	c.expect("G00", "E01")
+}
+
+func TestMemory(t *testing.T) {
+	c, stop := startServer(t)
+	defer stop()
+
+	c.expect("m200,4", "60016102")
+	c.expect("M300,3:abcdef", "OK")
+	c.expect("m2ff,5", "00abcdef00")
+	c.expect("m200", "E01")
+	c.expect("M300,2:ab", "E01")
+}
+
+func TestStep(t *testing.T) {
+	c, stop := startServer(t)
+	defer stop()
+
+	c.expect("s", "S05")
+	c.expect("p11", "0202")
+	c.expect("s204", "S05")
+	c.expect("p11", "0206")
+	c.expect("p0", "02")
+	c.expect("sxyz", "E01")
+	c.expect("s208", "W00")
+}
+
+func TestBreakpoints(t *testing.T) {
+	c, stop := startServer(t)
+	defer stop()
+
+	// the breakpoint stops the program before it executes the instruction
+	c.expect("Z0,204,2", "OK")
+	c.expect("c", "S05")
+	c.expect("g", registers("0102", 0, 0x204))
+	c.expect("c", "S05")
+	c.expect("g", registers("0202", 0, 0x204))
+
+	c.expect("z0,204,2", "OK")
+	c.expect("c208", "W00")
+}
+
+func TestChecksum(t *testing.T) {
+	c, stop := startServer(t)
+	defer stop()
+
+	// the client sends the packet again after it is rejected
+	c.write("$g#00")
+	if nak := c.readByte(); nak != '-' {
+		t.Fatalf("Packet with an invalid checksum was acknowledged with %q, expected '-'", nak)
+	}
+	c.expect("g", registers("", 0, 0x200))
+}
@@ -1,15 +1,25 @@
 package io
 
-const (
-	// DisplayWidth represents the width of the displat in pixels
-	DisplayWidth = 64
-	// DisplayHeight represents the height of the display in pixels
-	DisplayHeight = 32
+// Resolution represents the size of the display in pixels
+type Resolution struct {
+	Width  int
+	Height int
+}
+
+var (
+	// LowRes represents the 64x32 resolution of the original Chip-8
+	LowRes = Resolution{Width: 64, Height: 32}
+	// HighRes represents the 128x64 resolution of the SUPER-CHIP
+	HighRes = Resolution{Width: 128, Height: 64}
 )
 
-// Display can draw pixels onto the display
+// PlaneCount represents the number of bit planes that the display supports
+const PlaneCount = 2
+
+// Display renders the frames of the machine. Rendering backends only show the pixels, the machine
+// keeps the framebuffer and implements the drawing operations, so they behave the same on every backend.
 type Display interface {
-	Clear()
-	Draw(x, y int, sprite []byte) bool
-	Flush()
+	// Render shows the framebuffer. It is called at the end of every frame from the goroutine that
+	// runs the machine. The framebuffer must not be modified and must be copied to be retained.
+	Render(fb Framebuffer)
 }
@@ -0,0 +1,94 @@
+package io
+
+import (
+	"math/bits"
+)
+
+// Framebuffer holds the pixels of the display and implements the drawing operations of the machine
+type Framebuffer struct {
+	Resolution Resolution
+	Planes     byte   // the selected planes
+	Pixels     []byte // bit mask of the planes that each pixel is drawn on, row by row
+}
+
+// NewFramebuffer creates an empty framebuffer of the resolution with the first plane selected
+func NewFramebuffer(res Resolution) Framebuffer {
+	return Framebuffer{Resolution: res, Planes: 0x1, Pixels: make([]byte, res.Width*res.Height)}
+}
+
+// Copy returns a copy of the framebuffer that does not share its pixels
+func (fb *Framebuffer) Copy() Framebuffer {
+	pixels := make([]byte, len(fb.Pixels))
+	copy(pixels, fb.Pixels)
+	return Framebuffer{Resolution: fb.Resolution, Planes: fb.Planes, Pixels: pixels}
+}
+
+// Clear turns off all pixels of the selected planes
+func (fb *Framebuffer) Clear() {
+	for p := range fb.Pixels {
+		fb.Pixels[p] &^= fb.Planes
+	}
+}
+
+// SetResolution changes the size of the framebuffer and clears it
+func (fb *Framebuffer) SetResolution(res Resolution) {
+	fb.Resolution = res
+	fb.Pixels = make([]byte, res.Width*res.Height)
+}
+
+// SetPlanes selects the bit planes that subsequent operations apply to (XO-CHIP)
+func (fb *Framebuffer) SetPlanes(planes byte) {
+	fb.Planes = planes
+}
+
+// Scroll moves the contents of the selected planes by dx pixels to the right and dy pixels down
+func (fb *Framebuffer) Scroll(dx, dy int) {
+	width, height := fb.Resolution.Width, fb.Resolution.Height
+	pixels := make([]byte, len(fb.Pixels))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			p := y*width + x
+			pixels[p] = fb.Pixels[p] &^ fb.Planes
+
+			sx, sy := x-dx, y-dy
+			if sx >= 0 && sx < width && sy >= 0 && sy < height {
+				pixels[p] |= fb.Pixels[sy*width+sx] & fb.Planes
+			}
+		}
+	}
+	fb.Pixels = pixels
+}
+
+// Draw XORs the sprite onto the selected planes and reports whether any pixel was turned off.
+// The sprite is either 8 or 16 pixels wide, each line taking one or two bytes respectively.
+// When multiple planes are selected, the sprite data of each plane follows the previous one.
+// Sprites wrap around the edges of the framebuffer.
+func (fb *Framebuffer) Draw(x, y int, sprite []byte, width int) bool {
+	collision := false
+	bytesPerLine := width / 8
+	for plane := byte(0x1); plane < 1<<PlaneCount; plane <<= 1 {
+		if fb.Planes&plane == 0 {
+			continue
+		}
+
+		// the sprites for every selected plane are stored consecutively
+		size := len(sprite) / bits.OnesCount8(fb.Planes)
+		data := sprite[:size]
+		sprite = sprite[size:]
+
+		for dy := 0; dy < size/bytesPerLine; dy++ {
+			line := data[dy*bytesPerLine : (dy+1)*bytesPerLine]
+			for dx := 0; dx < width; dx++ {
+				if line[dx/8]&(1<<uint(7-dx%8)) == 0 {
+					continue
+				}
+				p := ((y+dy)%fb.Resolution.Height)*fb.Resolution.Width + (x+dx)%fb.Resolution.Width
+				if fb.Pixels[p]&plane > 0 {
+					collision = true
+				}
+				fb.Pixels[p] ^= plane
+			}
+		}
+	}
+	return collision
+}
@@ -0,0 +1,92 @@
+package headless
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/arjenvanderende/chip8/io"
+)
+
+// planeRunes maps the combination of planes that a pixel is drawn on to its character in String()
+var planeRunes = [4]rune{'.', '#', '+', '@'}
+
+// Display keeps the rendered frames in memory instead of drawing them to a screen,
+// so that programs can run without a terminal and their output can be inspected
+type Display struct {
+	frame  io.Framebuffer // the most recently rendered frame
+	frames int
+	mutex  sync.RWMutex
+}
+
+// NewDisplay creates a display that shows an empty low resolution frame
+func NewDisplay() *Display {
+	return &Display{frame: io.NewFramebuffer(io.LowRes)}
+}
+
+// Render keeps a copy of the frame and counts the number of frames that were rendered
+func (d *Display) Render(fb io.Framebuffer) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	d.frame = fb.Copy()
+	d.frames++
+}
+
+// Frames returns the number of frames that were rendered
+func (d *Display) Frames() int {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+
+	return d.frames
+}
+
+// Frame returns a copy of the most recently rendered frame
+func (d *Display) Frame() io.Framebuffer {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+
+	return d.frame.Copy()
+}
+
+// Pixels returns a copy of the most recently rendered frame, indexed by row and column.
+// Each pixel holds the bit mask of the planes that it is drawn on, 0 when it is off.
+func (d *Display) Pixels() [][]byte {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+
+	res := d.frame.Resolution
+	rows := make([][]byte, res.Height)
+	for y := range rows {
+		rows[y] = make([]byte, res.Width)
+		copy(rows[y], d.frame.Pixels[y*res.Width:(y+1)*res.Width])
+	}
+	return rows
+}
+
+// String dumps the most recently rendered frame as ASCII art, one line per row.
+// Pixels that are off are printed as '.', pixels on the first plane as '#',
+// on the second plane as '+' and on both planes as '@'.
+func (d *Display) String() string {
+	var b strings.Builder
+	for _, row := range d.Pixels() {
+		for _, planes := range row {
+			b.WriteRune(planeRunes[planes&0x3])
+		}
+		b.WriteRune('\n')
+	}
+	return b.String()
+}
+
+// Equal compares the most recently rendered frame against a golden frame in the format of String().
+// Leading and trailing whitespace of the frame and its lines are ignored.
+func (d *Display) Equal(frame string) bool {
+	return normalizeFrame(d.String()) == normalizeFrame(frame)
+}
+
+func normalizeFrame(frame string) string {
+	lines := strings.Split(strings.TrimSpace(frame), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimSpace(line)
+	}
+	return strings.Join(lines, "\n")
+}
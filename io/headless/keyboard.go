@@ -0,0 +1,205 @@
+package headless
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/arjenvanderende/chip8/io"
+)
+
+// KeyPress represents a key that is held down for a number of frames
+type KeyPress struct {
+	Frame    int    `json:"frame"`  // the frame in which the key is pressed
+	Key      io.Key `json:"key"`    // the key that is pressed
+	Duration int    `json:"frames"` // the number of frames that the key is held down
+}
+
+// Keyboard presses keys according to a script instead of reading them from a terminal.
+// The keyboard keeps track of time by counting the frames that the CPU completes,
+// so the script does not depend on the clock rate.
+type Keyboard struct {
+	script []KeyPress
+	frames int
+	mutex  sync.RWMutex
+}
+
+// NewKeyboard creates a keyboard that plays back the script
+func NewKeyboard(script []KeyPress) (*Keyboard, error) {
+	for i, press := range script {
+		if err := press.validate(); err != nil {
+			return nil, fmt.Errorf("Key press %d: %v", i+1, err)
+		}
+	}
+	sorted := make([]KeyPress, len(script))
+	copy(sorted, script)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Frame < sorted[j].Frame })
+
+	return &Keyboard{script: sorted}, nil
+}
+
+// validate checks that the key press starts at a frame of the program and lasts at least a frame
+func (press KeyPress) validate() error {
+	if press.Frame < 0 {
+		return fmt.Errorf("invalid frame %d", press.Frame)
+	}
+	if press.Duration < 1 {
+		return fmt.Errorf("invalid duration %d", press.Duration)
+	}
+	return nil
+}
+
+// LoadScript reads a script from a file. Files with the .json extension contain an
+// array of KeyPress objects, all other files are parsed by ParseScript.
+func LoadScript(filename string) ([]KeyPress, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to load key script %s: %v", filename, err)
+	}
+	if strings.ToLower(filepath.Ext(filename)) == ".json" {
+		var script []KeyPress
+		if err := json.Unmarshal(data, &script); err != nil {
+			return nil, fmt.Errorf("Unable to parse key script %s: %v", filename, err)
+		}
+		// like in textual scripts, keys are held down for a frame unless specified otherwise
+		for i := range script {
+			if script[i].Duration == 0 {
+				script[i].Duration = 1
+			}
+		}
+		return script, nil
+	}
+	return ParseScript(data)
+}
+
+// ParseScript parses a textual script. Every line contains the frame, the key and
+// optionally the number of frames to hold the key (defaults to 1), separated by spaces:
+//
+//	# start the game by pressing key 5 at frame 120 for 3 frames
+//	120 5 3
+//	200 esc
+//
+// Keys are hexadecimal digits or "esc". Empty lines and lines starting with '#' are ignored.
+func ParseScript(data []byte) ([]KeyPress, error) {
+	var script []KeyPress
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		fields := strings.Fields(text)
+		if len(fields) < 2 || len(fields) > 3 {
+			return nil, fmt.Errorf("Line %d: expected frame, key and optional duration, got %q", line, text)
+		}
+		press := KeyPress{Duration: 1}
+		frame, err := strconv.Atoi(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("Line %d: invalid frame %q", line, fields[0])
+		}
+		press.Frame = frame
+		key, err := parseKey(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("Line %d: %v", line, err)
+		}
+		press.Key = key
+		if len(fields) == 3 {
+			duration, err := strconv.Atoi(fields[2])
+			if err != nil {
+				return nil, fmt.Errorf("Line %d: invalid duration %q", line, fields[2])
+			}
+			press.Duration = duration
+		}
+		if err := press.validate(); err != nil {
+			return nil, fmt.Errorf("Line %d: %v", line, err)
+		}
+		script = append(script, press)
+	}
+	return script, scanner.Err()
+}
+
+func parseKey(s string) (io.Key, error) {
+	if strings.ToLower(s) == "esc" {
+		return io.KeyEsc, nil
+	}
+	key, err := strconv.ParseUint(s, 16, 8)
+	if err != nil || io.IsOperationalKey(io.Key(key)) {
+		return 0, fmt.Errorf("invalid key %q", s)
+	}
+	return io.Key(key), nil
+}
+
+// Tick is called for every CPU cycle, which does not advance the time of the script
+func (k *Keyboard) Tick() {
+}
+
+// VBlank advances the time of the script by one frame
+func (k *Keyboard) VBlank() {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	k.frames++
+}
+
+// Frame returns the current frame of the script
+func (k *Keyboard) Frame() int {
+	k.mutex.RLock()
+	defer k.mutex.RUnlock()
+
+	return k.frame()
+}
+
+func (k *Keyboard) frame() int {
+	return k.frames
+}
+
+// Done reports whether all key presses of the script have been played back
+func (k *Keyboard) Done() bool {
+	k.mutex.RLock()
+	defer k.mutex.RUnlock()
+
+	frame := k.frame()
+	for _, press := range k.script {
+		if frame < press.Frame+press.Duration {
+			return false
+		}
+	}
+	return true
+}
+
+// IsPressed reports whether the script holds down the key in the current frame
+func (k *Keyboard) IsPressed(key io.Key) bool {
+	k.mutex.RLock()
+	defer k.mutex.RUnlock()
+
+	frame := k.frame()
+	for _, press := range k.script {
+		if press.Key == key && frame >= press.Frame && frame < press.Frame+press.Duration {
+			return true
+		}
+	}
+	return false
+}
+
+// PressedButton returns the first key that the script holds down in the current frame
+func (k *Keyboard) PressedButton() *io.Key {
+	k.mutex.RLock()
+	defer k.mutex.RUnlock()
+
+	frame := k.frame()
+	for _, press := range k.script {
+		if frame >= press.Frame && frame < press.Frame+press.Duration {
+			key := press.Key
+			return &key
+		}
+	}
+	return nil
+}
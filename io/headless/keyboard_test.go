@@ -0,0 +1,68 @@
+package headless_test
+
+import (
+	"testing"
+
+	"github.com/arjenvanderende/chip8/chip8"
+	"github.com/arjenvanderende/chip8/io"
+	"github.com/arjenvanderende/chip8/io/headless"
+)
+
+func TestNewKeyboardValidatesScript(t *testing.T) {
+	tests := []struct {
+		name   string
+		script []headless.KeyPress
+		valid  bool
+	}{
+		{"empty", nil, true},
+		{"valid", []headless.KeyPress{{Frame: 0, Key: io.Key5, Duration: 1}}, true},
+		{"negative frame", []headless.KeyPress{{Frame: -1, Key: io.Key5, Duration: 1}}, false},
+		{"zero duration", []headless.KeyPress{{Frame: 3, Key: io.Key5, Duration: 0}}, false},
+		{"negative duration", []headless.KeyPress{{Frame: 3, Key: io.Key5, Duration: -2}}, false},
+	}
+	for _, test := range tests {
+		_, err := headless.NewKeyboard(test.script)
+		if (err == nil) != test.valid {
+			t.Errorf("%s: NewKeyboard() error = %v, expected valid = %v", test.name, err, test.valid)
+		}
+	}
+}
+
+func TestParseScriptRejectsNegativeValues(t *testing.T) {
+	for _, script := range []string{"-1 5", "10 5 -3", "10 5 0"} {
+		if _, err := headless.ParseScript([]byte(script)); err == nil {
+			t.Errorf("ParseScript(%q) succeeded, expected an error", script)
+		}
+	}
+}
+
+// TestScriptFollowsFrames checks that a key press reaches the program in the same frame,
+// regardless of the number of cycles that the CPU executes per frame
+func TestScriptFollowsFrames(t *testing.T) {
+	// LD V0, K followed by an endless loop
+	program := []byte{0xf0, 0x0a, 0x12, 0x02}
+	for _, clockRate := range []int{300, 540, 1200} {
+		cpu, err := chip8.LoadBytes(program, chip8.Quirks{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		cpu.SetClockRate(clockRate)
+		keyboard, err := headless.NewKeyboard([]headless.KeyPress{{Frame: 10, Key: io.Key5, Duration: 1}})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		frame := -1
+		for f := 0; f < 20 && frame < 0; f++ {
+			if _, err := cpu.RunFrame(headless.NewDisplay(), keyboard); err != nil {
+				t.Fatal(err)
+			}
+			if cpu.Registers().V[0] == 5 {
+				frame = keyboard.Frame()
+			}
+		}
+		if frame != 11 {
+			t.Errorf("clock rate %d: key was read before frame %d, expected 11", clockRate, frame)
+		}
+	}
+}
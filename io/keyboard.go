@@ -6,6 +6,12 @@ type Keyboard interface {
 	PressedButton() *Key
 }
 
+// VBlanker is implemented by keyboards that keep time in frames instead of CPU cycles.
+// The machine calls VBlank at the end of every frame.
+type VBlanker interface {
+	VBlank()
+}
+
 type Key byte
 
 const (
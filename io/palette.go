@@ -0,0 +1,63 @@
+package io
+
+import (
+	"fmt"
+	"image/color"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Palette maps the combination of planes that a pixel is drawn on to its color,
+// starting with the background and ending with the pixels that are drawn on both planes
+type Palette [1 << PlaneCount]color.RGBA
+
+// ParseColor parses colors in the #rrggbb notation
+func ParseColor(s string) (color.RGBA, error) {
+	hex := strings.TrimPrefix(s, "#")
+	if len(hex) != 6 {
+		return color.RGBA{}, fmt.Errorf("Invalid color %s, expected #rrggbb", s)
+	}
+	v, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil {
+		return color.RGBA{}, fmt.Errorf("Invalid color %s, expected #rrggbb", s)
+	}
+	return rgb(uint32(v)), nil
+}
+
+// FormatColor formats the color in the #rrggbb notation
+func FormatColor(c color.RGBA) string {
+	return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+}
+
+// Themes contains named palettes for the display
+var Themes = map[string]Palette{
+	"classic":  {rgb(0x000000), rgb(0x33ff33), rgb(0xff3333), rgb(0xffff33)},
+	"amber":    {rgb(0x1a0f00), rgb(0xffb000), rgb(0xa86800), rgb(0xffe0a0)},
+	"lcd":      {rgb(0xc4cfa1), rgb(0x1e2a14), rgb(0x7a8a55), rgb(0x44552e)},
+	"contrast": {rgb(0x000000), rgb(0xffffff), rgb(0x00ffff), rgb(0xffff00)},
+	"octo":     {rgb(0x996600), rgb(0xffcc00), rgb(0xff6600), rgb(0x662200)},
+}
+
+// LookupTheme returns the palette of the theme by its name
+func LookupTheme(name string) (Palette, error) {
+	palette, ok := Themes[name]
+	if !ok {
+		return Palette{}, fmt.Errorf("Unknown theme %s, expected one of %v", name, ThemeNames())
+	}
+	return palette, nil
+}
+
+// ThemeNames returns the sorted names of the available themes
+func ThemeNames() []string {
+	names := make([]string, 0, len(Themes))
+	for name := range Themes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func rgb(v uint32) color.RGBA {
+	return color.RGBA{R: byte(v >> 16), G: byte(v >> 8), B: byte(v), A: 0xff}
+}
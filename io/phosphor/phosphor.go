@@ -0,0 +1,50 @@
+// Package phosphor reduces the flicker of programs that erase and redraw their sprites every frame
+package phosphor
+
+import (
+	"github.com/arjenvanderende/chip8/io"
+)
+
+// Display shows pixels for a number of frames after they were turned off, like the phosphor of a CRT.
+// It only filters the frames that are rendered, the machine keeps the actual pixels and detects
+// collisions, so programs can not tell the difference.
+type Display struct {
+	display io.Display
+	frames  int
+	res     io.Resolution
+	decay   []int  // number of frames that each pixel remains visible after it was turned off
+	shown   []byte // the planes that each pixel was last drawn on
+}
+
+// NewDisplay creates a display that keeps pixels visible for the number of frames after they
+// were turned off and renders the result on the display
+func NewDisplay(display io.Display, frames int) *Display {
+	return &Display{display: display, frames: frames}
+}
+
+// Render shows the pixels that are on and those that were turned off recently
+func (d *Display) Render(fb io.Framebuffer) {
+	// forget the pixels that were turned off when the size changes
+	if fb.Resolution != d.res {
+		d.res = fb.Resolution
+		d.decay = make([]int, len(fb.Pixels))
+		d.shown = make([]byte, len(fb.Pixels))
+	}
+
+	for p, planes := range fb.Pixels {
+		if planes != 0 {
+			d.decay[p] = d.frames
+			d.shown[p] = planes
+		} else if d.decay[p] > 0 {
+			d.decay[p]--
+		} else {
+			d.shown[p] = 0
+		}
+	}
+	d.display.Render(io.Framebuffer{Resolution: fb.Resolution, Planes: fb.Planes, Pixels: d.shown})
+}
+
+// Unwrap returns the underlying display
+func (d *Display) Unwrap() io.Display {
+	return d.display
+}
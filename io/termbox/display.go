@@ -1,53 +1,43 @@
 package termbox
 
 import (
-	"log"
-
 	"github.com/arjenvanderende/chip8/io"
 	"github.com/nsf/termbox-go"
 )
 
-type display struct {
-	pixels [io.DisplayWidth * io.DisplayHeight]bool
+// planeColors maps the combination of planes that a pixel is drawn on to its color
+var planeColors = [4]termbox.Attribute{
+	termbox.ColorDefault,
+	termbox.ColorGreen,
+	termbox.ColorRed,
+	termbox.ColorYellow,
 }
 
-func (s *display) Clear() {
-	termbox.Clear(termbox.ColorDefault, termbox.ColorDefault)
-	s.pixels = [io.DisplayWidth * io.DisplayHeight]bool{}
+type display struct {
+	res    io.Resolution
+	pixels []byte // bit mask of the planes that each pixel is drawn on
+	colors [4]termbox.Attribute
+	render Render
 }
 
-func (s *display) Flush() {
-	termbox.Flush()
+func newDisplay(palette *io.Palette, render Render) *display {
+	d := &display{res: io.LowRes, colors: planeColors, render: render}
+	if palette != nil {
+		mode := termbox.SetOutputMode(outputMode())
+		d.colors = paletteColors(palette, mode)
+	}
+	termbox.Clear(termbox.ColorDefault, d.colors[0])
+	return d
 }
 
-func (s *display) Draw(x, y int, sprite []byte) bool {
-	collision := false
-	for dy, line := range sprite {
-		log.Printf("DRAW X=%d, Y=%d: %08b\n", x, y, line)
-		for dx := 0; dx < 8; dx++ {
-			// determine if pixel is on or off
-			p := (((y + dy) * io.DisplayWidth) + x + dx) % (io.DisplayWidth * io.DisplayHeight)
-			a := line&(1<<uint(7-dx)) > 0
-			b := s.pixels[p]
-			on := a != b
-
-			// collision detection
-			if a == b && a == true {
-				collision = true
-			}
-
-			// draw pixel
-			rx := p % io.DisplayWidth
-			ry := p / io.DisplayWidth
-			if on {
-				termbox.SetCell(rx, ry, '█', termbox.ColorGreen, termbox.ColorDefault)
-			} else {
-				termbox.SetCell(rx, ry, ' ', termbox.ColorDefault, termbox.ColorDefault)
-			}
-
-			// remember the state
-			s.pixels[p] = on
-		}
+// Render composites the pixels of the frame onto the cells of the terminal and flushes them
+func (s *display) Render(fb io.Framebuffer) {
+	// the cells are only cleared when the size changes, so that rendering does not erase other panes
+	if fb.Resolution != s.res {
+		s.res = fb.Resolution
+		termbox.Clear(termbox.ColorDefault, s.colors[0])
 	}
-	return collision
+	s.pixels = append(s.pixels[:0], fb.Pixels...)
+	s.composite()
+	termbox.Flush()
 }
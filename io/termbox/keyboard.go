@@ -13,13 +13,24 @@ const keyPressDuration uint8 = 1
 type keyboard struct {
 	pressedKeys  map[io.Key]uint8
 	waitForPress chan io.Key
+	hotkeys      Hotkeys
+	keys         map[rune]io.Key
 	mutex        sync.RWMutex
 }
 
-func newKeyboard() *keyboard {
+func newKeyboard(hotkeys Hotkeys, keys map[rune]io.Key) *keyboard {
+	mapping := make(map[rune]io.Key, len(keyMapping)+len(keys))
+	for ch, key := range keyMapping {
+		mapping[ch] = key
+	}
+	for ch, key := range keys {
+		mapping[unicode.ToLower(ch)] = key
+	}
 	return &keyboard{
 		pressedKeys:  make(map[io.Key]uint8),
 		waitForPress: nil,
+		hotkeys:      hotkeys,
+		keys:         mapping,
 	}
 }
 
@@ -40,10 +51,12 @@ func (k *keyboard) poll() {
 		event := termbox.PollEvent()
 		switch event.Type {
 		case termbox.EventKey:
-			if key, ok := keyMapping[unicode.ToLower(event.Ch)]; ok {
+			if key, ok := k.keys[unicode.ToLower(event.Ch)]; ok {
 				k.registerKeyPress(key)
 			} else if event.Key == termbox.KeyEsc {
 				k.registerKeyPress(io.KeyEsc)
+			} else if action, ok := k.hotkeys[Hotkey{Ch: event.Ch, Key: event.Key}]; ok {
+				action()
 			}
 		case termbox.EventInterrupt:
 			return
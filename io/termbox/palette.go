@@ -0,0 +1,99 @@
+package termbox
+
+import (
+	"image/color"
+	"os"
+	"strings"
+
+	"github.com/arjenvanderende/chip8/io"
+	"github.com/nsf/termbox-go"
+)
+
+// cubeLevels are the intensities of the 6x6x6 color cube of 256-color terminals
+var cubeLevels = [6]int{0, 95, 135, 175, 215, 255}
+
+// ansiColors are the intensities of the 8 colors of terminals without 256-color support,
+// in the order of the termbox attributes
+var ansiColors = [8]color.RGBA{
+	{0, 0, 0, 0xff}, {205, 0, 0, 0xff}, {0, 205, 0, 0xff}, {205, 205, 0, 0xff},
+	{0, 0, 238, 0xff}, {205, 0, 205, 0xff}, {0, 205, 205, 0xff}, {229, 229, 229, 0xff},
+}
+
+// outputMode returns the 256-color mode when the terminal supports it, and the normal mode of 8 colors
+// otherwise. Terminals that announce truecolor support get the 256-color mode as well, because termbox
+// has no RGB output mode, so the colors of the palette are rounded to the nearest of the 256 colors.
+func outputMode() termbox.OutputMode {
+	term := os.Getenv("TERM")
+	if os.Getenv("COLORTERM") != "" || strings.Contains(term, "256color") || strings.Contains(term, "direct") {
+		return termbox.Output256
+	}
+	return termbox.OutputNormal
+}
+
+// paletteColors returns the colors of the output mode that are nearest to the palette
+func paletteColors(palette *io.Palette, mode termbox.OutputMode) [4]termbox.Attribute {
+	var colors [4]termbox.Attribute
+	for i, c := range palette {
+		if mode == termbox.Output256 {
+			colors[i] = nearestColor(c)
+		} else {
+			colors[i] = nearestANSIColor(c)
+		}
+	}
+	return colors
+}
+
+// nearestANSIColor returns the one of the 8 colors of the normal output mode that is nearest to c
+func nearestANSIColor(c color.RGBA) termbox.Attribute {
+	best, distance := 0, -1
+	for i, a := range ansiColors {
+		d := square(int(c.R)-int(a.R)) + square(int(c.G)-int(a.G)) + square(int(c.B)-int(a.B))
+		if distance < 0 || d < distance {
+			best, distance = i, d
+		}
+	}
+	return termbox.ColorBlack + termbox.Attribute(best)
+}
+
+// nearestColor returns the color of the cube or the grayscale ramp that is nearest to c
+func nearestColor(c color.RGBA) termbox.Attribute {
+	level := func(v uint8) int {
+		best := 0
+		for i, l := range cubeLevels {
+			if abs(int(v)-l) < abs(int(v)-cubeLevels[best]) {
+				best = i
+			}
+		}
+		return best
+	}
+	r, g, b := level(c.R), level(c.G), level(c.B)
+	index := 16 + 36*r + 6*g + b
+	distance := square(int(c.R)-cubeLevels[r]) + square(int(c.G)-cubeLevels[g]) + square(int(c.B)-cubeLevels[b])
+
+	// the grayscale ramp runs from 8 to 238 in steps of 10
+	gray := (int(c.R) + int(c.G) + int(c.B)) / 3
+	step := (gray - 8 + 5) / 10
+	if step < 0 {
+		step = 0
+	} else if step > 23 {
+		step = 23
+	}
+	level8 := 8 + 10*step
+	if d := square(int(c.R)-level8) + square(int(c.G)-level8) + square(int(c.B)-level8); d < distance {
+		index = 232 + step
+	}
+
+	// in the 256-color output mode, attributes start at 1
+	return termbox.Attribute(index + 1)
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+func square(x int) int {
+	return x * x
+}
@@ -0,0 +1,160 @@
+package termbox
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/arjenvanderende/chip8/io"
+	"github.com/nsf/termbox-go"
+)
+
+// Render selects how the pixels of the display are mapped onto the cells of the terminal
+type Render int
+
+const (
+	// RenderBlock draws every pixel as a full block, which stretches the picture vertically
+	RenderBlock Render = iota
+	// RenderHalfBlock draws two pixels above each other in every cell, so pixels are square
+	RenderHalfBlock
+	// RenderBraille draws 2x4 pixels in every cell as a braille pattern in a single color
+	RenderBraille
+)
+
+var renderNames = map[string]Render{
+	"block":     RenderBlock,
+	"halfblock": RenderHalfBlock,
+	"braille":   RenderBraille,
+}
+
+// ParseRender returns the render mode by its name
+func ParseRender(name string) (Render, error) {
+	render, ok := renderNames[name]
+	if !ok {
+		return RenderBlock, fmt.Errorf("Unknown render mode %s, expected one of %v", name, RenderNames())
+	}
+	return render, nil
+}
+
+// RenderNames returns the sorted names of the available render modes
+func RenderNames() []string {
+	names := make([]string, 0, len(renderNames))
+	for name := range renderNames {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// cellSize returns the number of pixels that every cell of the terminal shows
+func (r Render) cellSize() (width, height int) {
+	switch r {
+	case RenderHalfBlock:
+		return 1, 2
+	case RenderBraille:
+		return 2, 4
+	default:
+		return 1, 1
+	}
+}
+
+// size returns the number of cells of the terminal that a display of the resolution occupies
+func (r Render) size(res io.Resolution) (width, height int) {
+	w, h := r.cellSize()
+	return (res.Width + w - 1) / w, (res.Height + h - 1) / h
+}
+
+// Size returns the number of cells of the terminal that the display occupies for frames of the
+// resolution. Displays that wrap another display are unwrapped, other displays are assumed to
+// take a cell per pixel.
+func Size(d io.Display, res io.Resolution) (width, height int) {
+	for d != nil {
+		if s, ok := d.(*display); ok {
+			return s.render.size(res)
+		}
+		wrapper, ok := d.(interface{ Unwrap() io.Display })
+		if !ok {
+			break
+		}
+		d = wrapper.Unwrap()
+	}
+	return res.Width, res.Height
+}
+
+// brailleDots maps the pixels of a cell, row by row, onto the dots of a braille pattern
+var brailleDots = [4][2]rune{
+	{0x01, 0x08},
+	{0x02, 0x10},
+	{0x04, 0x20},
+	{0x40, 0x80},
+}
+
+// composite draws the pixels onto the cells of the terminal
+func (s *display) composite() {
+	width, height := s.render.size(s.res)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			switch s.render {
+			case RenderHalfBlock:
+				s.setHalfBlock(x, y, s.pixel(x, 2*y), s.pixel(x, 2*y+1))
+			case RenderBraille:
+				s.setBraille(x, y)
+			default:
+				s.setBlock(x, y, s.pixel(x, y))
+			}
+		}
+	}
+}
+
+// pixel returns the planes that the pixel is drawn on, 0 for pixels outside of the display
+func (s *display) pixel(x, y int) byte {
+	if x >= s.res.Width || y >= s.res.Height {
+		return 0
+	}
+	return s.pixels[y*s.res.Width+x] & 0x3
+}
+
+func (s *display) setBlock(x, y int, planes byte) {
+	if planes != 0 {
+		termbox.SetCell(x, y, '█', s.colors[planes], s.colors[0])
+	} else {
+		termbox.SetCell(x, y, ' ', termbox.ColorDefault, s.colors[0])
+	}
+}
+
+func (s *display) setHalfBlock(x, y int, top, bottom byte) {
+	switch {
+	case top == bottom:
+		s.setBlock(x, y, top)
+	case bottom == 0:
+		termbox.SetCell(x, y, '▀', s.colors[top], s.colors[0])
+	case top == 0:
+		termbox.SetCell(x, y, '▄', s.colors[bottom], s.colors[0])
+	default:
+		termbox.SetCell(x, y, '▀', s.colors[top], s.colors[bottom])
+	}
+}
+
+// setBraille draws the pattern of the lit pixels of the cell in the color that most of them share
+func (s *display) setBraille(x, y int) {
+	var pattern rune
+	var counts [4]int
+	for dy := 0; dy < 4; dy++ {
+		for dx := 0; dx < 2; dx++ {
+			if planes := s.pixel(2*x+dx, 4*y+dy); planes != 0 {
+				pattern |= brailleDots[dy][dx]
+				counts[planes]++
+			}
+		}
+	}
+	if pattern == 0 {
+		s.setBlock(x, y, 0)
+		return
+	}
+	planes := 1
+	for p := 2; p < len(counts); p++ {
+		if counts[p] > counts[planes] {
+			planes = p
+		}
+	}
+	termbox.SetCell(x, y, 0x2800+pattern, s.colors[planes], s.colors[0])
+}
@@ -8,18 +8,41 @@ import (
 // Closer disposes the display and keyboard that the termbox library initialises
 type Closer func()
 
-// New initialises a display and keyboard device via the termbox library
-func New() (io.Display, io.Keyboard, Closer, error) {
+// Hotkey identifies a key of the terminal that is not part of the Chip-8 keypad
+type Hotkey struct {
+	Ch  rune        // the character of the key, 0 for special keys
+	Key termbox.Key // the special key, 0 for character keys
+}
+
+// FunctionKey returns the hotkey of function key F1 through F12
+func FunctionKey(n int) Hotkey {
+	return Hotkey{Key: termbox.KeyF1 - termbox.Key(n-1)}
+}
+
+// Hotkeys maps keys of the terminal onto actions of the frontend, like pausing the program
+type Hotkeys map[Hotkey]func()
+
+// Options configures the display and keyboard devices
+type Options struct {
+	Hotkeys Hotkeys         // the actions of keys that are not part of the keypad
+	Palette *io.Palette     // the colors of the display, nil to use the colors of the terminal
+	Keys    map[rune]io.Key // keys that are mapped onto the keypad in addition to the default layout
+	Render  Render          // how the pixels are mapped onto the cells of the terminal
+}
+
+// New initialises a display and keyboard device via the termbox library.
+// The actions of the hotkeys are invoked from the goroutine that polls the keyboard.
+func New(options Options) (io.Display, io.Keyboard, Closer, error) {
 	err := termbox.Init()
 	if err != nil {
 		return nil, nil, nil, err
 	}
 
 	termbox.SetInputMode(termbox.InputEsc)
-	keyboard := newKeyboard()
+	keyboard := newKeyboard(options.Hotkeys, options.Keys)
 	go keyboard.poll()
 
-	return &display{}, keyboard, func() {
+	return newDisplay(options.Palette, options.Render), keyboard, func() {
 		// release all resources
 		keyboard.close()
 		termbox.Close()
@@ -1,21 +1,88 @@
 package main
 
 import (
+	"archive/zip"
+	"bytes"
+	"context"
 	"flag"
 	"fmt"
+	"image/color"
 	"io"
+	"io/ioutil"
 	"log"
 	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
 
+	"github.com/arjenvanderende/chip8/asm"
+	"github.com/arjenvanderende/chip8/cartridge"
 	"github.com/arjenvanderende/chip8/chip8"
+	"github.com/arjenvanderende/chip8/dap"
+	"github.com/arjenvanderende/chip8/debugger"
+	"github.com/arjenvanderende/chip8/gdb"
+	chipio "github.com/arjenvanderende/chip8/io"
+	"github.com/arjenvanderende/chip8/io/headless"
+	"github.com/arjenvanderende/chip8/io/phosphor"
 	"github.com/arjenvanderende/chip8/io/termbox"
+	"github.com/arjenvanderende/chip8/octo"
 )
 
 func main() {
-	decompile := flag.Bool("decompile", false, "Print opcodes of the loaded ROM")
-	filename := flag.String("romfile", "roms/fishie.ch8", "The ROM file to load")
+	// subcommands
+	args := os.Args[1:]
+	if len(args) > 0 && args[0] == "asm" {
+		if err := assemble(args[1:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if len(args) > 0 && args[0] == "cart" {
+		if err := pack(args[1:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	// run takes the program as argument instead of -romfile, e.g. run foo.8o
+	runProgram := len(args) > 0 && args[0] == "run"
+	if runProgram {
+		args = args[1:]
+	}
+
+	decompile := flag.Bool("decompile", false, "Print the assembly of the loaded ROM, which can be assembled again with the asm subcommand")
+	filename := flag.String("romfile", "roms/fishie.ch8", "The ROM file to load, - for stdin or archive.zip:file for a file in a zip archive. Octo source files (.8o) and cartridges (.gif) are compiled first")
 	logfile := flag.String("logfile", "", "The file to log to")
-	flag.Parse()
+	preset := flag.String("quirks", "default", fmt.Sprintf("The quirks preset to emulate, one of %v", chip8.QuirksPresetNames()))
+	vfReset := flag.Bool("quirk-vfreset", false, "Reset VF after the logical operations 8xy1, 8xy2 and 8xy3")
+	memory := flag.Bool("quirk-memory", false, "Increment I after storing or loading registers with Fx55 and Fx65")
+	clipping := flag.Bool("quirk-clipping", false, "Clip sprites at the edges of the display instead of wrapping them")
+	shifting := flag.Bool("quirk-shifting", false, "Shift Vx in place for 8xy6 and 8xyE instead of shifting Vy")
+	jumping := flag.Bool("quirk-jumping", false, "Jump to nnn + Vx for Bnnn instead of nnn + V0")
+	deterministic := flag.Bool("deterministic", false, "Execute a fixed number of cycles per frame and seed the random number generator, so runs are reproducible")
+	seed := flag.Int64("seed", 0, "The seed for the random number generator in deterministic mode")
+	rewindDepth := flag.Int("rewind-depth", 600, "The number of frames that can be rewound with the 'b' key, recorded every frame by default, 0 disables rewinding")
+	rewindBudget := flag.Int("rewind-budget", 16, "The maximum amount of memory in MB to use for rewinding, including a copy of the emulated memory")
+	theme := flag.String("theme", "", fmt.Sprintf("The colors of the display, one of %v, defaults to the colors of the terminal; colors are rounded to the 256-color palette, also on truecolor terminals", chipio.ThemeNames()))
+	foreground := flag.String("fg", "", "The #rrggbb color of the pixels, overriding the theme and rounded to the 256-color palette")
+	background := flag.String("bg", "", "The #rrggbb color of the background, overriding the theme and rounded to the 256-color palette")
+	persistence := flag.Int("phosphor", 0, "The number of frames that pixels remain visible after they are turned off, which reduces flicker")
+	renderName := flag.String("render", "block", fmt.Sprintf("How pixels are drawn in the terminal, one of %v", termbox.RenderNames()))
+	debug := flag.Bool("debug", false, "Run the program in the interactive debugger")
+	gdbAddr := flag.String("gdb", "", "Serve the GDB remote protocol on the address (e.g. :1234) instead of running the program")
+	romDatabase := flag.String("romdb", "", "A ROM database file whose entries override the bundled ones, defaults to roms.json in the chip8 user config directory")
+	dapAddr := flag.String("dap", "", "Serve the Debug Adapter Protocol on stdio or the address (e.g. :4711) instead of running the program")
+	flag.CommandLine.Parse(args)
+	if runProgram {
+		if flag.NArg() != 1 {
+			log.Fatal("Usage: chip8 run [flags] program")
+		}
+		*filename = flag.Arg(0)
+	}
+
+	if *filename == "-" && *dapAddr == "stdio" {
+		log.Fatal("The ROM file can not be read from stdin while serving the debug adapter on stdio")
+	}
 
 	// setup logging
 	if *logfile != "" {
@@ -26,46 +93,392 @@ func main() {
 		log.SetOutput(f)
 	}
 
+	// determine the quirks, individual flags override the preset, which overrides the quirks of cartridges
+	presetQuirks, err := chip8.LookupQuirks(*preset)
+	if err != nil {
+		log.Fatal(err)
+	}
+	quirksFor := func(defaults chip8.Quirks) chip8.Quirks {
+		quirks := defaults
+		flag.Visit(func(f *flag.Flag) {
+			if f.Name == "quirks" {
+				quirks = presetQuirks
+			}
+		})
+		flag.Visit(func(f *flag.Flag) {
+			switch f.Name {
+			case "quirk-vfreset":
+				quirks.VFReset = *vfReset
+			case "quirk-memory":
+				quirks.Memory = *memory
+			case "quirk-clipping":
+				quirks.Clipping = *clipping
+			case "quirk-shifting":
+				quirks.Shifting = *shifting
+			case "quirk-jumping":
+				quirks.Jumping = *jumping
+			}
+		})
+		return quirks
+	}
+
+	render, err := termbox.ParseRender(*renderName)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// determine the colors, the flags override the colors of cartridges and the ROM database
+	paletteFor, err := paletteFlags(*theme, *foreground, *background)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// the ROM database selects the quirks and clock rate of known ROMs
+	if err := loadROMDatabase(*romDatabase); err != nil {
+		log.Fatal(err)
+	}
+
 	// load the ROM file
-	cpu, err := chip8.Load(*filename)
+	var options termbox.Options
+	load := func(filename string) (*chip8.CPU, error) {
+		cpu, cart, err := loadProgram(filename, presetQuirks)
+		if err != nil {
+			return nil, err
+		}
+		cpu.SetQuirks(quirksFor(cpu.Quirks()))
+		options = romOptions(cpu)
+		options.Render = render
+		if cart != nil {
+			cpu.SetClockRate(cart.ClockRate())
+			if options.Palette, err = cart.Palette(); err != nil {
+				log.Print(err)
+			}
+		}
+		options.Palette = paletteFor(options.Palette)
+		if *rewindDepth > 0 {
+			cpu.EnableRewind(*rewindDepth, *rewindBudget<<20)
+		}
+		if *deterministic {
+			cpu.Seed(*seed)
+			cpu.SetVirtualClock(true)
+		}
+		return cpu, nil
+	}
+	cpu, err := load(*filename)
 	if err != nil {
 		log.Fatal(err)
 	}
 
 	// disassemble opcodes
 	if *decompile {
-		printOpcodes(os.Stdout, cpu)
+		if err := asm.Disassemble(os.Stdout, cpu.Program()); err != nil {
+			log.Fatal(err)
+		}
+	} else if *dapAddr == "stdio" {
+		// stdout carries the protocol, so the program runs without a terminal display
+		keyboard, err := headless.NewKeyboard(nil)
+		if err != nil {
+			log.Fatal(err)
+		}
+		server := dap.NewServer(cpu, load, headless.NewDisplay(), keyboard)
+		if err := server.Serve(context.Background(), os.Stdin, os.Stdout); err != nil {
+			log.Fatal(fmt.Errorf("Debug adapter failed: %v", err))
+		}
 	} else {
-		err = run(cpu)
+		err = run(cpu, load, options, *persistence, *filename, *debug, *gdbAddr, *dapAddr)
 		if err != nil {
 			log.Fatal(err)
 		}
 	}
 }
 
-func printOpcodes(w io.Writer, cpu *chip8.CPU) {
-	for {
-		op := cpu.DisassembleOp()
-		fmt.Fprintf(w, "%s\n", op)
+// loadProgram loads the ROM file, the program that is compiled from an Octo source file (.8o)
+// or the program of an Octo cartridge, which comes with options that select its quirks.
+// The default quirks are used when neither the ROM database nor the cartridge specify them.
+func loadProgram(filename string, defaults chip8.Quirks) (*chip8.CPU, *cartridge.Options, error) {
+	name, data, err := readProgram(filename)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Unable to load Chip8 file %s: %v", filename, err)
+	}
 
-		if !cpu.NextOp() {
-			break
+	if filepath.Ext(name) == ".8o" {
+		program, err := octo.Compile(name, data)
+		if err != nil {
+			return nil, nil, err
+		}
+		cpu, err := chip8.LoadBytes(program.Code, defaults)
+		return cpu, nil, err
+	}
+	if !cartridge.IsCartridge(data) {
+		cpu, err := chip8.LoadBytes(data, defaults)
+		if err != nil {
+			return nil, nil, fmt.Errorf("Unable to load Chip8 file %s: %v", filename, err)
 		}
+		return cpu, nil, nil
 	}
+
+	cart, err := cartridge.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, nil, err
+	}
+	program, err := octo.Compile(name, []byte(cart.Program))
+	if err != nil {
+		return nil, nil, err
+	}
+	cpu, err := chip8.LoadBytes(program.Code, defaults)
+	if err != nil {
+		return nil, nil, err
+	}
+	cpu.SetQuirks(cart.Options.Quirks())
+	for _, name := range cart.Options.UnsupportedQuirks() {
+		log.Printf("Cartridge %s enables %s, which is not supported and ignored", filename, name)
+	}
+	return cpu, &cart.Options, nil
+}
+
+// loadROMDatabase loads the ROM database file, or the one in the user config directory if it exists
+func loadROMDatabase(filename string) error {
+	if filename != "" {
+		return chip8.LoadROMDatabase(filename)
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return nil
+	}
+	filename = filepath.Join(dir, "chip8", "roms.json")
+	if _, err := os.Stat(filename); err != nil {
+		return nil
+	}
+	return chip8.LoadROMDatabase(filename)
 }
 
-func run(cpu *chip8.CPU) error {
+// paletteFlags parses the theme and colors of the command line. It returns a function that applies them
+// to the palette of the loaded program, which is nil when the colors of the terminal are used.
+func paletteFlags(theme, foreground, background string) (func(*chipio.Palette) *chipio.Palette, error) {
+	var themePalette *chipio.Palette
+	if theme != "" {
+		palette, err := chipio.LookupTheme(theme)
+		if err != nil {
+			return nil, err
+		}
+		themePalette = &palette
+	}
+	fg, err := parseColorFlag(foreground)
+	if err != nil {
+		return nil, err
+	}
+	bg, err := parseColorFlag(background)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(defaults *chipio.Palette) *chipio.Palette {
+		palette := defaults
+		if themePalette != nil {
+			palette = themePalette
+		}
+		if fg == nil && bg == nil {
+			return palette
+		}
+		custom := chipio.Themes["classic"]
+		if palette != nil {
+			custom = *palette
+		}
+		if fg != nil {
+			custom[1] = *fg
+		}
+		if bg != nil {
+			custom[0] = *bg
+		}
+		return &custom
+	}, nil
+}
+
+// parseColorFlag parses the color of a flag, which is nil when the flag is not set
+func parseColorFlag(s string) (*color.RGBA, error) {
+	if s == "" {
+		return nil, nil
+	}
+	c, err := chipio.ParseColor(s)
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// romOptions returns the colors and keys that the ROM database lists for the loaded ROM
+func romOptions(cpu *chip8.CPU) termbox.Options {
+	var options termbox.Options
+	info, ok := cpu.ROMInfo()
+	if !ok {
+		return options
+	}
+	log.Printf("Loaded %s (%s)", info.Title, cpu.ROMHash())
+
+	if len(info.Colors) > 0 {
+		palette, err := parsePalette(strings.Join(info.Colors, ","))
+		if err != nil {
+			log.Print(err)
+		} else {
+			options.Palette = &palette
+		}
+	}
+	if len(info.Keys) > 0 {
+		options.Keys = make(map[rune]chipio.Key)
+		for ch, key := range info.Keys {
+			k, err := strconv.ParseUint(key, 16, 4)
+			if len([]rune(ch)) != 1 || err != nil {
+				log.Printf("Invalid key binding %s: %s", ch, key)
+				continue
+			}
+			options.Keys[[]rune(ch)[0]] = chipio.Key(k)
+		}
+	}
+	return options
+}
+
+// readProgram reads the program from the file, from stdin when the file is - or from an entry
+// of a zip archive when the file is written as archive.zip:entry. The entry may be left out
+// when the archive contains a single file. It returns the name of the file that was read.
+func readProgram(filename string) (string, []byte, error) {
+	if filename == "-" {
+		data, err := ioutil.ReadAll(os.Stdin)
+		return filename, data, err
+	}
+
+	archive, entry := filename, ""
+	if i := strings.Index(filename, ".zip:"); i >= 0 {
+		archive, entry = filename[:i+len(".zip")], filename[i+len(".zip:"):]
+	} else if filepath.Ext(filename) != ".zip" {
+		data, err := ioutil.ReadFile(filename)
+		return filename, data, err
+	}
+
+	r, err := zip.OpenReader(archive)
+	if err != nil {
+		return "", nil, err
+	}
+	defer r.Close()
+
+	var files []*zip.File
+	for _, f := range r.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		if entry == "" || f.Name == entry || path.Base(f.Name) == entry {
+			files = append(files, f)
+		}
+	}
+	if len(files) != 1 {
+		names := make([]string, 0, len(r.File))
+		for _, f := range r.File {
+			if !f.FileInfo().IsDir() {
+				names = append(names, f.Name)
+			}
+		}
+		if entry == "" {
+			return "", nil, fmt.Errorf("Archive contains multiple files, select one of %v with %s:<file>", names, archive)
+		}
+		return "", nil, fmt.Errorf("Archive does not contain exactly one file named %s, expected one of %v", entry, names)
+	}
+
+	rc, err := files[0].Open()
+	if err != nil {
+		return "", nil, err
+	}
+	defer rc.Close()
+	data, err := ioutil.ReadAll(io.LimitReader(rc, int64(chip8.MaxProgramSize+1)))
+	return files[0].Name, data, err
+}
+
+// saveSlots represents the number of save states that can be stored per ROM
+const saveSlots = 4
+
+// rewindFrames represents the number of frames to go back per repeat of the rewind key
+const rewindFrames = 4
+
+func run(cpu *chip8.CPU, load dap.LoadFunc, options termbox.Options, persistence int, romfile string, debug bool, gdbAddr, dapAddr string) error {
 	// initialise I/O devices
-	display, keyboard, closer, err := termbox.New()
+	control := cpu.Controller()
+	hotkeys := termbox.Hotkeys{
+		{Ch: 'p'}: control.Toggle,
+		{Ch: 'n'}: control.Step,
+	}
+	// holding 'b' repeats the key, so every repeat goes back a couple of frames
+	hotkeys[termbox.Hotkey{Ch: 'b'}] = func() {
+		control.Do(func() {
+			cpu.Rewind(rewindFrames)
+		})
+	}
+
+	// F1-F4 save the state to a slot, F5-F8 load the state from that slot
+	for slot := 1; slot <= saveSlots; slot++ {
+		filename := fmt.Sprintf("%s.state%d", romfile, slot)
+		hotkeys[termbox.FunctionKey(slot)] = func() {
+			control.Do(func() {
+				if err := saveState(filename, cpu); err != nil {
+					log.Print(err)
+				}
+			})
+		}
+		hotkeys[termbox.FunctionKey(saveSlots+slot)] = func() {
+			control.Do(func() {
+				if err := loadState(filename, cpu); err != nil {
+					log.Print(err)
+				}
+			})
+		}
+	}
+
+	var dbg *debugger.Debugger
+	if debug {
+		dbg = debugger.New(cpu)
+		for key, action := range dbg.Hotkeys() {
+			hotkeys[key] = action
+		}
+	}
+	options.Hotkeys = hotkeys
+	display, keyboard, closer, err := termbox.New(options)
 	if err != nil {
 		return fmt.Errorf("Unable to initialise graphics: %v", err)
 	}
 	defer closer()
+	if persistence > 0 {
+		display = phosphor.NewDisplay(display, persistence)
+	}
 
 	// run the program
-	err = cpu.Run(display, keyboard)
+	if dbg != nil {
+		err = dbg.Run(context.Background(), display, keyboard)
+	} else if gdbAddr != "" {
+		err = gdb.NewServer(cpu, display, keyboard).ListenAndServe(context.Background(), gdbAddr)
+	} else if dapAddr != "" {
+		err = dap.NewServer(cpu, load, display, keyboard).ListenAndServe(context.Background(), dapAddr)
+	} else {
+		err = cpu.Run(context.Background(), display, keyboard)
+	}
 	if err != nil {
 		return fmt.Errorf("Program failed to run: %v", err)
 	}
 	return nil
 }
+
+func saveState(filename string, cpu *chip8.CPU) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return fmt.Errorf("Unable to create save state: %v", err)
+	}
+	defer f.Close()
+
+	return cpu.SaveState(f)
+}
+
+func loadState(filename string, cpu *chip8.CPU) error {
+	f, err := os.Open(filename)
+	if err != nil {
+		return fmt.Errorf("Unable to open save state: %v", err)
+	}
+	defer f.Close()
+
+	return cpu.LoadState(f)
+}
@@ -0,0 +1,142 @@
+package octo
+
+import (
+	"fmt"
+	"math"
+)
+
+var (
+	unaryOperators = map[string]func(x float64) float64{
+		"-":     func(x float64) float64 { return -x },
+		"~":     func(x float64) float64 { return float64(^int(x)) },
+		"!":     func(x float64) float64 { return boolValue(x == 0) },
+		"sin":   math.Sin,
+		"cos":   math.Cos,
+		"tan":   math.Tan,
+		"exp":   math.Exp,
+		"log":   math.Log,
+		"abs":   math.Abs,
+		"sqrt":  math.Sqrt,
+		"ceil":  math.Ceil,
+		"floor": math.Floor,
+		"sign": func(x float64) float64 {
+			if x < 0 {
+				return -1
+			} else if x > 0 {
+				return 1
+			}
+			return 0
+		},
+	}
+	binaryOperators = map[string]func(x, y float64) float64{
+		"+":   func(x, y float64) float64 { return x + y },
+		"-":   func(x, y float64) float64 { return x - y },
+		"*":   func(x, y float64) float64 { return x * y },
+		"/":   func(x, y float64) float64 { return x / y },
+		"%":   func(x, y float64) float64 { return float64(int(x) % int(y)) },
+		"&":   func(x, y float64) float64 { return float64(int(x) & int(y)) },
+		"|":   func(x, y float64) float64 { return float64(int(x) | int(y)) },
+		"^":   func(x, y float64) float64 { return float64(int(x) ^ int(y)) },
+		"<<":  func(x, y float64) float64 { return float64(int(x) << uint(y)) },
+		">>":  func(x, y float64) float64 { return float64(int(x) >> uint(y)) },
+		"pow": math.Pow,
+		"min": math.Min,
+		"max": math.Max,
+		"<":   func(x, y float64) float64 { return boolValue(x < y) },
+		"<=":  func(x, y float64) float64 { return boolValue(x <= y) },
+		">":   func(x, y float64) float64 { return boolValue(x > y) },
+		">=":  func(x, y float64) float64 { return boolValue(x >= y) },
+		"==":  func(x, y float64) float64 { return boolValue(x == y) },
+		"!=":  func(x, y float64) float64 { return boolValue(x != y) },
+	}
+)
+
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// calc evaluates the expression between the braces that the compiler is positioned at.
+// Like Octo, operators have no precedence and are evaluated from right to left.
+func (c *compiler) calc() (float64, error) {
+	if err := c.expect("{"); err != nil {
+		return 0, err
+	}
+	value, err := c.expression()
+	if err != nil {
+		return 0, err
+	}
+	return value, c.expect("}")
+}
+
+func (c *compiler) expression() (float64, error) {
+	x, err := c.term()
+	if err != nil {
+		return 0, err
+	}
+	if c.peek() == "}" || c.peek() == ")" {
+		return x, nil
+	}
+	t, err := c.next()
+	if err != nil {
+		return 0, err
+	}
+	op, ok := binaryOperators[t.text]
+	if !ok {
+		return 0, fmt.Errorf("Unknown operator %s", t.text)
+	}
+	y, err := c.expression()
+	if err != nil {
+		return 0, err
+	}
+	return op(x, y), nil
+}
+
+func (c *compiler) term() (float64, error) {
+	t, err := c.next()
+	if err != nil {
+		return 0, err
+	}
+	if t.text == "(" {
+		value, err := c.expression()
+		if err != nil {
+			return 0, err
+		}
+		return value, c.expect(")")
+	}
+	if t.text == "@" {
+		addr, err := c.term()
+		if err != nil {
+			return 0, err
+		}
+		return float64(c.byteAt(int(addr))), nil
+	}
+	if op, ok := unaryOperators[t.text]; ok {
+		x, err := c.term()
+		if err != nil {
+			return 0, err
+		}
+		return op(x), nil
+	}
+
+	switch t.text {
+	case "HERE":
+		return float64(c.here), nil
+	case "PI":
+		return math.Pi, nil
+	case "E":
+		return math.E, nil
+	}
+	if value, ok := c.constants[t.text]; ok {
+		return value, nil
+	}
+	if addr, ok := c.labels[t.text]; ok {
+		return float64(addr), nil
+	}
+	if n, ok := parseNumber(t.text); ok {
+		return float64(n), nil
+	}
+	return 0, fmt.Errorf("Unknown name %s in calculation", t.text)
+}
@@ -0,0 +1,978 @@
+// Package octo compiles programs that are written in Octo, the high-level assembly language
+// for the Chip-8, to bytecode. Comparisons other than == and != use VF as a temporary register.
+package octo
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+
+	"github.com/arjenvanderende/chip8/asm"
+	"github.com/arjenvanderende/chip8/sourcemap"
+)
+
+const (
+	// origin represents the address at which programs are loaded
+	origin = 0x200
+	// maxAddress represents the last address of the memory
+	maxAddress = 0xffff
+	// maxExpansions limits the number of macro expansions, to stop recursive macros
+	maxExpansions = 10000
+)
+
+// fixupKind selects how the address of a label is stored once it is defined
+type fixupKind int
+
+const (
+	fixupAddr     fixupKind = iota // the low 12 bits of the instruction
+	fixupLong                      // the 16-bit word
+	fixupUnpackHi                  // the low nibble of the byte receives the high nibble of the address
+	fixupUnpackLo                  // the byte receives the low byte of the address
+)
+
+// fixup represents a reference to a label that was not defined yet
+type fixup struct {
+	addr  int
+	kind  fixupKind
+	label token
+}
+
+// block represents a loop or if ... begin that has not been closed yet
+type block struct {
+	loop   bool
+	start  int   // the address that again jumps back to
+	jumps  []int // the jumps to the end of the block
+	orElse bool  // whether the else branch was started
+}
+
+type macro struct {
+	args []string
+	body []token
+}
+
+type compiler struct {
+	tokens []token
+	pos    int
+
+	code []byte // the memory from the origin onwards
+	here int
+	size int // the number of bytes of code that were written
+
+	labels    map[string]int
+	constants map[string]float64
+	aliases   map[string]byte
+	macros    map[string]*macro
+	fixups    []fixup
+	blocks    []*block
+
+	expansions int
+	mainFirst  bool  // whether main is at the start of the program
+	mainLabel  token // the definition of main
+	sources    *sourcemap.Map
+	mapped     map[int]bool
+}
+
+// CompileFile compiles the Octo source file
+func CompileFile(filename string) (*asm.Program, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read source file: %v", err)
+	}
+	return Compile(filename, data)
+}
+
+// Compile compiles the Octo source. The program starts with a jump to the label main,
+// unless main is the first label of the program.
+func Compile(filename string, source []byte) (*asm.Program, error) {
+	c := &compiler{
+		tokens:    tokenize(filename, source),
+		here:      origin,
+		labels:    make(map[string]int),
+		constants: make(map[string]float64),
+		aliases:   make(map[string]byte),
+		macros:    make(map[string]*macro),
+		sources:   &sourcemap.Map{Symbols: make(map[string]int)},
+		mapped:    make(map[int]bool),
+	}
+
+	// reserve room for the jump to main
+	c.emit(0x00, 0x00)
+	for c.pos < len(c.tokens) {
+		t := c.tokens[c.pos]
+		if err := c.statement(); err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", t.file, t.line, err)
+		}
+	}
+	if len(c.blocks) > 0 {
+		return nil, fmt.Errorf("%s: Missing again or end", filename)
+	}
+
+	main, ok := c.labels["main"]
+	if !ok {
+		return nil, fmt.Errorf("%s: Missing label main", filename)
+	}
+	if !c.mainFirst {
+		if main > 0xfff {
+			return nil, fmt.Errorf("%s:%d: Label main at %x is out of range of the jump at the start of the program",
+				c.mainLabel.file, c.mainLabel.line, main)
+		}
+		c.patch(origin, 0x1000|main)
+	}
+	for _, f := range c.fixups {
+		addr, ok := c.labels[f.label.text]
+		if !ok {
+			return nil, fmt.Errorf("%s:%d: Undefined label %s", f.label.file, f.label.line, f.label.text)
+		}
+		if err := c.resolve(f, addr); err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", f.label.file, f.label.line, err)
+		}
+	}
+
+	for name, addr := range c.labels {
+		c.sources.Symbols[name] = addr
+	}
+	return &asm.Program{Code: c.code[:c.size], Sources: c.sources}, nil
+}
+
+func (c *compiler) peek() string {
+	if c.pos < len(c.tokens) {
+		return c.tokens[c.pos].text
+	}
+	return ""
+}
+
+func (c *compiler) next() (token, error) {
+	if c.pos >= len(c.tokens) {
+		return token{}, fmt.Errorf("Unexpected end of file")
+	}
+	c.pos++
+	return c.tokens[c.pos-1], nil
+}
+
+func (c *compiler) expect(text string) error {
+	t, err := c.next()
+	if err != nil {
+		return err
+	}
+	if t.text != text {
+		return fmt.Errorf("Expected %s instead of %s", text, t.text)
+	}
+	return nil
+}
+
+// emit writes the bytes at the current address
+func (c *compiler) emit(b ...byte) error {
+	for _, v := range b {
+		if c.here > maxAddress {
+			return fmt.Errorf("Program does not fit in memory")
+		}
+		for len(c.code) <= c.here-origin {
+			c.code = append(c.code, 0)
+		}
+		c.code[c.here-origin] = v
+		c.here++
+		if c.here-origin > c.size {
+			c.size = c.here - origin
+		}
+	}
+	return nil
+}
+
+// inst writes the 16-bit instruction
+func (c *compiler) inst(op int) error {
+	return c.emit(byte(op>>8), byte(op))
+}
+
+// patch overwrites the 16-bit word at the address
+func (c *compiler) patch(addr, op int) {
+	c.code[addr-origin] = byte(op >> 8)
+	c.code[addr-origin+1] = byte(op)
+}
+
+func (c *compiler) byteAt(addr int) byte {
+	if addr < origin || addr-origin >= len(c.code) {
+		return 0
+	}
+	return c.code[addr-origin]
+}
+
+// resolve stores the address of the label in the instruction that references it
+func (c *compiler) resolve(f fixup, addr int) error {
+	i := f.addr - origin
+	switch f.kind {
+	case fixupAddr:
+		if addr > 0xfff {
+			return fmt.Errorf("Address %x of label %s is out of range, use i := long", addr, f.label.text)
+		}
+		c.code[i] = c.code[i]&0xf0 | byte(addr>>8)&0x0f
+		c.code[i+1] = byte(addr)
+	case fixupLong:
+		c.code[i] = byte(addr >> 8)
+		c.code[i+1] = byte(addr)
+	case fixupUnpackHi:
+		c.code[i] = c.code[i]&0xf0 | byte(addr>>8)&0x0f
+	case fixupUnpackLo:
+		c.code[i] = byte(addr)
+	}
+	return nil
+}
+
+// statement compiles the next statement
+func (c *compiler) statement() error {
+	t, err := c.next()
+	if err != nil {
+		return err
+	}
+	start := c.here
+	defer func() {
+		if c.here > start && !c.mapped[start] {
+			c.mapped[start] = true
+			c.sources.Add(start, t.file, t.line)
+		}
+	}()
+
+	if m, ok := c.macros[t.text]; ok {
+		return c.expand(m)
+	}
+	if r, ok := c.register(t.text); ok {
+		return c.assignment(r)
+	}
+
+	switch t.text {
+	case ":":
+		name, err := c.name()
+		if err != nil {
+			return err
+		}
+		if name == "main" {
+			c.mainLabel = t
+			if c.here == origin+2 && c.size == 2 {
+				// the program starts with main, so the jump to main is left out,
+				// which moves the labels that were defined at the same address too
+				c.here, c.size, c.mainFirst = origin, 0, true
+				for name, addr := range c.labels {
+					c.labels[name] = addr - 2
+				}
+			}
+		}
+		return c.define(name, c.here)
+	case ":next":
+		name, err := c.name()
+		if err != nil {
+			return err
+		}
+		return c.define(name, c.here+1)
+	case ":const":
+		name, err := c.name()
+		if err != nil {
+			return err
+		}
+		value, err := c.value()
+		if err != nil {
+			return err
+		}
+		c.constants[name] = float64(value)
+		return nil
+	case ":calc":
+		name, err := c.name()
+		if err != nil {
+			return err
+		}
+		value, err := c.calc()
+		if err != nil {
+			return err
+		}
+		c.constants[name] = value
+		return nil
+	case ":alias":
+		name, err := c.name()
+		if err != nil {
+			return err
+		}
+		r, err := c.nextRegister()
+		if err != nil {
+			return err
+		}
+		c.aliases[name] = r
+		return nil
+	case ":macro":
+		return c.defineMacro()
+	case ":unpack":
+		return c.unpack()
+	case ":org":
+		addr, err := c.value()
+		if err != nil {
+			return err
+		}
+		if addr < origin || addr > maxAddress {
+			return fmt.Errorf("Address %x is outside of the program", addr)
+		}
+		c.here = addr
+		return nil
+	case ":byte":
+		var value int
+		if c.peek() == "{" {
+			v, err := c.calc()
+			if err != nil {
+				return err
+			}
+			value = int(v)
+		} else if value, err = c.value(); err != nil {
+			return err
+		}
+		return c.emitByte(value)
+	case ":breakpoint":
+		_, err := c.next()
+		return err
+	case ":monitor":
+		if _, err := c.next(); err != nil {
+			return err
+		}
+		_, err := c.next()
+		return err
+	case "clear":
+		return c.inst(0x00e0)
+	case "return", ";":
+		return c.inst(0x00ee)
+	case "scroll-right":
+		return c.inst(0x00fb)
+	case "scroll-left":
+		return c.inst(0x00fc)
+	case "exit":
+		return c.inst(0x00fd)
+	case "lores":
+		return c.inst(0x00fe)
+	case "hires":
+		return c.inst(0x00ff)
+	case "audio":
+		return c.inst(0xf002)
+	case "scroll-down":
+		return c.nibbleInst(0x00c0, 0)
+	case "scroll-up":
+		return c.nibbleInst(0x00d0, 0)
+	case "plane":
+		return c.nibbleInst(0xf001, 8)
+	case "bcd":
+		return c.registerInst(0xf033)
+	case "saveflags":
+		return c.registerInst(0xf075)
+	case "loadflags":
+		return c.registerInst(0xf085)
+	case "save", "load":
+		return c.saveLoad(t.text == "save")
+	case "sprite":
+		x, err := c.nextRegister()
+		if err != nil {
+			return err
+		}
+		y, err := c.nextRegister()
+		if err != nil {
+			return err
+		}
+		n, err := c.rangedValue(0, 0xf)
+		if err != nil {
+			return err
+		}
+		return c.inst(0xd000 | int(x)<<8 | int(y)<<4 | n)
+	case "jump":
+		return c.addrInst(0x1000)
+	case "jump0":
+		return c.addrInst(0xb000)
+	case "native":
+		return c.addrInst(0x0000)
+	case "i":
+		return c.indexAssignment()
+	case "delay", "buzzer", "pitch":
+		if err := c.expect(":="); err != nil {
+			return err
+		}
+		op := map[string]int{"delay": 0xf015, "buzzer": 0xf018, "pitch": 0xf03a}[t.text]
+		return c.registerInst(op)
+	case "if":
+		return c.ifStatement()
+	case "else":
+		return c.elseStatement()
+	case "end":
+		return c.endStatement()
+	case "loop":
+		c.blocks = append(c.blocks, &block{loop: true, start: c.here})
+		return nil
+	case "while":
+		return c.whileStatement()
+	case "again":
+		return c.againStatement()
+	}
+
+	// bare numbers are data, bare names call the subroutine with that name
+	if n, ok := parseNumber(t.text); ok {
+		return c.emitByte(n)
+	}
+	if value, ok := c.constants[t.text]; ok {
+		return c.emitByte(int(value))
+	}
+	if strings.HasPrefix(t.text, ":") {
+		return fmt.Errorf("Unsupported directive %s", t.text)
+	}
+	return c.addrRef(0x2000, t)
+}
+
+// name returns the next token as the name of a label, constant or alias
+func (c *compiler) name() (string, error) {
+	t, err := c.next()
+	if err != nil {
+		return "", err
+	}
+	if _, ok := parseNumber(t.text); ok {
+		return "", fmt.Errorf("Invalid name %s", t.text)
+	}
+	if _, ok := c.register(t.text); ok && !isAlias(c.aliases, t.text) {
+		return "", fmt.Errorf("Name %s is a register", t.text)
+	}
+	return t.text, nil
+}
+
+func isAlias(aliases map[string]byte, name string) bool {
+	_, ok := aliases[name]
+	return ok
+}
+
+func (c *compiler) define(name string, addr int) error {
+	if _, ok := c.labels[name]; ok {
+		return fmt.Errorf("Label %s is already defined", name)
+	}
+	c.labels[name] = addr
+	return nil
+}
+
+func (c *compiler) defineMacro() error {
+	name, err := c.name()
+	if err != nil {
+		return err
+	}
+	m := &macro{}
+	for c.peek() != "{" {
+		arg, err := c.next()
+		if err != nil {
+			return err
+		}
+		m.args = append(m.args, arg.text)
+	}
+	c.pos++
+
+	for depth := 1; ; {
+		t, err := c.next()
+		if err != nil {
+			return err
+		}
+		if t.text == "{" {
+			depth++
+		} else if t.text == "}" {
+			depth--
+			if depth == 0 {
+				break
+			}
+		}
+		m.body = append(m.body, t)
+	}
+	c.macros[name] = m
+	return nil
+}
+
+// expand replaces the invocation of the macro with its body
+func (c *compiler) expand(m *macro) error {
+	c.expansions++
+	if c.expansions > maxExpansions {
+		return fmt.Errorf("Too many macro expansions")
+	}
+	args := make(map[string]token)
+	for _, name := range m.args {
+		arg, err := c.next()
+		if err != nil {
+			return err
+		}
+		args[name] = arg
+	}
+	body := make([]token, len(m.body))
+	for i, t := range m.body {
+		if arg, ok := args[t.text]; ok {
+			t.text = arg.text
+		}
+		body[i] = t
+	}
+	rest := append(body, c.tokens[c.pos:]...)
+	c.tokens = append(c.tokens[:c.pos:c.pos], rest...)
+	return nil
+}
+
+// register returns the index of the register vX or its alias
+func (c *compiler) register(name string) (byte, bool) {
+	if r, ok := c.aliases[name]; ok {
+		return r, true
+	}
+	if len(name) != 2 || name[0] != 'v' && name[0] != 'V' {
+		return 0, false
+	}
+	r, err := strconv.ParseUint(name[1:], 16, 4)
+	return byte(r), err == nil
+}
+
+func (c *compiler) nextRegister() (byte, error) {
+	t, err := c.next()
+	if err != nil {
+		return 0, err
+	}
+	r, ok := c.register(t.text)
+	if !ok {
+		return 0, fmt.Errorf("Expected a register instead of %s", t.text)
+	}
+	return r, nil
+}
+
+// parseNumber parses decimal, hexadecimal (0x) and binary (0b) numbers
+func parseNumber(text string) (int, bool) {
+	sign, digits := 1, text
+	if strings.HasPrefix(digits, "-") {
+		sign, digits = -1, digits[1:]
+	}
+	base := 10
+	if strings.HasPrefix(digits, "0x") || strings.HasPrefix(digits, "0X") {
+		base, digits = 16, digits[2:]
+	} else if strings.HasPrefix(digits, "0b") || strings.HasPrefix(digits, "0B") {
+		base, digits = 2, digits[2:]
+	}
+	n, err := strconv.ParseUint(digits, base, 32)
+	if err != nil {
+		return 0, false
+	}
+	return sign * int(n), true
+}
+
+// value returns the next number, constant or defined label
+func (c *compiler) value() (int, error) {
+	t, err := c.next()
+	if err != nil {
+		return 0, err
+	}
+	if n, ok := parseNumber(t.text); ok {
+		return n, nil
+	}
+	if value, ok := c.constants[t.text]; ok {
+		return int(value), nil
+	}
+	if addr, ok := c.labels[t.text]; ok {
+		return addr, nil
+	}
+	return 0, fmt.Errorf("Unknown value %s", t.text)
+}
+
+// rangedValue returns the next value, which must lie within the range
+func (c *compiler) rangedValue(min, max int) (int, error) {
+	value, err := c.value()
+	if err != nil {
+		return 0, err
+	}
+	if value < min || value > max {
+		return 0, fmt.Errorf("Value %d is out of range %d-%d", value, min, max)
+	}
+	return value, nil
+}
+
+// byteValue returns the next value as a byte, negative values are stored in two's complement
+func (c *compiler) byteValue() (int, error) {
+	value, err := c.rangedValue(-128, 255)
+	return value & 0xff, err
+}
+
+func (c *compiler) emitByte(value int) error {
+	if value < -128 || value > 255 {
+		return fmt.Errorf("Value %d does not fit in a byte", value)
+	}
+	return c.emit(byte(value))
+}
+
+func (c *compiler) nibbleInst(op int, shift uint) error {
+	n, err := c.rangedValue(0, 0xf)
+	if err != nil {
+		return err
+	}
+	return c.inst(op | n<<shift)
+}
+
+func (c *compiler) registerInst(op int) error {
+	r, err := c.nextRegister()
+	if err != nil {
+		return err
+	}
+	return c.inst(op | int(r)<<8)
+}
+
+// addrInst writes the instruction with the address of the next token
+func (c *compiler) addrInst(op int) error {
+	t, err := c.next()
+	if err != nil {
+		return err
+	}
+	return c.addrRef(op, t)
+}
+
+// addrRef writes the instruction with the address of the token, which may be a label that is defined later on
+func (c *compiler) addrRef(op int, t token) error {
+	addr, ok := c.labels[t.text]
+	if !ok {
+		if value, isConst := c.constants[t.text]; isConst {
+			addr, ok = int(value), true
+		} else if n, isNumber := parseNumber(t.text); isNumber {
+			addr, ok = n, true
+		}
+	}
+	if !ok {
+		c.fixups = append(c.fixups, fixup{addr: c.here, kind: fixupAddr, label: t})
+	} else if addr < 0 || addr > 0xfff {
+		return fmt.Errorf("Address %x is out of range, use i := long", addr)
+	}
+	return c.inst(op | addr&0xfff)
+}
+
+// saveLoad compiles save vx, load vx and their ranges save vx - vy and load vx - vy
+func (c *compiler) saveLoad(save bool) error {
+	x, err := c.nextRegister()
+	if err != nil {
+		return err
+	}
+	if c.peek() != "-" {
+		if save {
+			return c.inst(0xf055 | int(x)<<8)
+		}
+		return c.inst(0xf065 | int(x)<<8)
+	}
+	c.pos++
+	y, err := c.nextRegister()
+	if err != nil {
+		return err
+	}
+	if save {
+		return c.inst(0x5002 | int(x)<<8 | int(y)<<4)
+	}
+	return c.inst(0x5003 | int(x)<<8 | int(y)<<4)
+}
+
+func (c *compiler) unpack() error {
+	nibble, err := c.rangedValue(0, 0xf)
+	if err != nil {
+		return err
+	}
+	t, err := c.next()
+	if err != nil {
+		return err
+	}
+	addr, ok := c.labels[t.text]
+	if value, isConst := c.constants[t.text]; !ok && isConst {
+		addr, ok = int(value), true
+	}
+	if !ok {
+		c.fixups = append(c.fixups,
+			fixup{addr: c.here + 1, kind: fixupUnpackHi, label: t},
+			fixup{addr: c.here + 3, kind: fixupUnpackLo, label: t})
+	}
+	// v0 := nibble and high nibble of the address, v1 := low byte of the address
+	if err := c.inst(0x6000 | nibble<<4 | addr>>8&0xf); err != nil {
+		return err
+	}
+	return c.inst(0x6100 | addr&0xff)
+}
+
+// assignment compiles the operations on the register vx
+func (c *compiler) assignment(x byte) error {
+	op, err := c.next()
+	if err != nil {
+		return err
+	}
+	rx := int(x) << 8
+
+	switch op.text {
+	case ":=":
+		switch c.peek() {
+		case "random":
+			c.pos++
+			n, err := c.byteValue()
+			if err != nil {
+				return err
+			}
+			return c.inst(0xc000 | rx | n)
+		case "key":
+			c.pos++
+			return c.inst(0xf00a | rx)
+		case "delay":
+			c.pos++
+			return c.inst(0xf007 | rx)
+		}
+		if y, ok := c.register(c.peek()); ok {
+			c.pos++
+			return c.inst(0x8000 | rx | int(y)<<4)
+		}
+		n, err := c.byteValue()
+		if err != nil {
+			return err
+		}
+		return c.inst(0x6000 | rx | n)
+	case "+=", "-=":
+		if y, ok := c.register(c.peek()); ok {
+			c.pos++
+			if op.text == "+=" {
+				return c.inst(0x8004 | rx | int(y)<<4)
+			}
+			return c.inst(0x8005 | rx | int(y)<<4)
+		}
+		n, err := c.byteValue()
+		if err != nil {
+			return err
+		}
+		if op.text == "-=" {
+			n = -n & 0xff
+		}
+		return c.inst(0x7000 | rx | n)
+	}
+
+	ops := map[string]int{"|=": 0x8001, "&=": 0x8002, "^=": 0x8003, ">>=": 0x8006, "=-": 0x8007, "<<=": 0x800e}
+	code, ok := ops[op.text]
+	if !ok {
+		return fmt.Errorf("Unknown operator %s", op.text)
+	}
+	y, err := c.nextRegister()
+	if err != nil {
+		return err
+	}
+	return c.inst(code | rx | int(y)<<4)
+}
+
+// indexAssignment compiles the operations on the register i
+func (c *compiler) indexAssignment() error {
+	op, err := c.next()
+	if err != nil {
+		return err
+	}
+	if op.text == "+=" {
+		return c.registerInst(0xf01e)
+	}
+	if op.text != ":=" {
+		return fmt.Errorf("Unknown operator %s", op.text)
+	}
+
+	switch c.peek() {
+	case "hex":
+		c.pos++
+		return c.registerInst(0xf029)
+	case "bighex":
+		c.pos++
+		return c.registerInst(0xf030)
+	case "long":
+		c.pos++
+		t, err := c.next()
+		if err != nil {
+			return err
+		}
+		addr, ok := c.labels[t.text]
+		if value, isConst := c.constants[t.text]; !ok && isConst {
+			addr, ok = int(value), true
+		} else if n, isNumber := parseNumber(t.text); !ok && isNumber {
+			addr, ok = n, true
+		}
+		if err := c.inst(0xf000); err != nil {
+			return err
+		}
+		if !ok {
+			c.fixups = append(c.fixups, fixup{addr: c.here, kind: fixupLong, label: t})
+		}
+		return c.inst(addr & 0xffff)
+	}
+	return c.addrInst(0xa000)
+}
+
+// condition represents the comparison of a register with a register or value
+type condition struct {
+	x        byte
+	operator string
+	y        byte
+	register bool // whether y is a register, or value holds the right-hand side
+	value    int
+}
+
+var negations = map[string]string{
+	"==": "!=", "!=": "==",
+	"<": ">=", ">=": "<",
+	">": "<=", "<=": ">",
+	"key": "-key", "-key": "key",
+}
+
+func (c *compiler) condition() (condition, error) {
+	x, err := c.nextRegister()
+	if err != nil {
+		return condition{}, err
+	}
+	op, err := c.next()
+	if err != nil {
+		return condition{}, err
+	}
+	cond := condition{x: x, operator: op.text}
+	if _, ok := negations[op.text]; !ok {
+		return condition{}, fmt.Errorf("Unknown comparison %s", op.text)
+	}
+	if op.text == "key" || op.text == "-key" {
+		return cond, nil
+	}
+	if y, ok := c.register(c.peek()); ok {
+		c.pos++
+		cond.y, cond.register = y, true
+		return cond, nil
+	}
+	cond.value, err = c.byteValue()
+	return cond, err
+}
+
+// skipUnless writes the instructions that skip the next instruction unless the condition is true
+func (c *compiler) skipUnless(cond condition) error {
+	rx, ry := int(cond.x)<<8, int(cond.y)<<4
+	switch cond.operator {
+	case "key":
+		return c.inst(0xe0a1 | rx)
+	case "-key":
+		return c.inst(0xe09e | rx)
+	case "==":
+		if cond.register {
+			return c.inst(0x9000 | rx | ry)
+		}
+		return c.inst(0x4000 | rx | cond.value)
+	case "!=":
+		if cond.register {
+			return c.inst(0x5000 | rx | ry)
+		}
+		return c.inst(0x3000 | rx | cond.value)
+	}
+
+	// VF is set to 1 when the left-hand side is not smaller than the right-hand side
+	var ops []int
+	swap := cond.operator == ">" || cond.operator == "<="
+	switch {
+	case cond.register && swap:
+		ops = []int{0x8f00 | int(cond.y)<<4, 0x8f05 | int(cond.x)<<4}
+	case cond.register:
+		ops = []int{0x8f00 | int(cond.x)<<4, 0x8f05 | int(cond.y)<<4}
+	case swap:
+		ops = []int{0x6f00 | cond.value, 0x8f05 | int(cond.x)<<4}
+	default:
+		ops = []int{0x6f00 | cond.value, 0x8f07 | int(cond.x)<<4}
+	}
+	if cond.operator == "<" || cond.operator == ">" {
+		ops = append(ops, 0x3f01)
+	} else {
+		ops = append(ops, 0x3f00)
+	}
+	for _, op := range ops {
+		if err := c.inst(op); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *compiler) ifStatement() error {
+	cond, err := c.condition()
+	if err != nil {
+		return err
+	}
+	t, err := c.next()
+	if err != nil {
+		return err
+	}
+
+	switch t.text {
+	case "then":
+		if err := c.skipUnless(cond); err != nil {
+			return err
+		}
+		return c.statement()
+	case "begin":
+		cond.operator = negations[cond.operator]
+		if err := c.skipUnless(cond); err != nil {
+			return err
+		}
+		c.blocks = append(c.blocks, &block{jumps: []int{c.here}})
+		return c.inst(0x1000)
+	}
+	return fmt.Errorf("Expected then or begin instead of %s", t.text)
+}
+
+func (c *compiler) elseStatement() error {
+	b := c.innermost()
+	if b == nil || b.loop || b.orElse {
+		return fmt.Errorf("Else without if ... begin")
+	}
+	// jump from the end of the then branch to the end, the skipped branch continues here
+	jump := c.here
+	if err := c.inst(0x1000); err != nil {
+		return err
+	}
+	c.jumpHere(b.jumps)
+	b.jumps, b.orElse = []int{jump}, true
+	return nil
+}
+
+func (c *compiler) endStatement() error {
+	b := c.innermost()
+	if b == nil || b.loop {
+		return fmt.Errorf("End without if ... begin")
+	}
+	c.blocks = c.blocks[:len(c.blocks)-1]
+	c.jumpHere(b.jumps)
+	return nil
+}
+
+func (c *compiler) whileStatement() error {
+	var b *block
+	for i := len(c.blocks) - 1; i >= 0 && b == nil; i-- {
+		if c.blocks[i].loop {
+			b = c.blocks[i]
+		}
+	}
+	if b == nil {
+		return fmt.Errorf("While outside of loop")
+	}
+	cond, err := c.condition()
+	if err != nil {
+		return err
+	}
+	cond.operator = negations[cond.operator]
+	if err := c.skipUnless(cond); err != nil {
+		return err
+	}
+	b.jumps = append(b.jumps, c.here)
+	return c.inst(0x1000)
+}
+
+func (c *compiler) againStatement() error {
+	b := c.innermost()
+	if b == nil || !b.loop {
+		return fmt.Errorf("Again without loop")
+	}
+	c.blocks = c.blocks[:len(c.blocks)-1]
+	if err := c.inst(0x1000 | b.start); err != nil {
+		return err
+	}
+	c.jumpHere(b.jumps)
+	return nil
+}
+
+func (c *compiler) innermost() *block {
+	if len(c.blocks) == 0 {
+		return nil
+	}
+	return c.blocks[len(c.blocks)-1]
+}
+
+// jumpHere points the jump instructions at the current address
+func (c *compiler) jumpHere(jumps []int) {
+	for _, addr := range jumps {
+		c.patch(addr, 0x1000|c.here&0xfff)
+	}
+}
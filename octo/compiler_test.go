@@ -0,0 +1,112 @@
+package octo
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestCompileControlFlow(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		code   []byte
+	}{
+		{"if then", ": main if v0 == 5 then v1 := 2", []byte{
+			0x40, 0x05, // 200: SNE V0, 05
+			0x61, 0x02, // 202: LD V1, 02
+		}},
+		{"if then register", ": main if v0 != v1 then v1 := 2", []byte{
+			0x50, 0x10, // 200: SE V0, V1
+			0x61, 0x02, // 202: LD V1, 02
+		}},
+		{"if then less than", ": main if v0 < 3 then v1 := 1", []byte{
+			0x6f, 0x03, // 200: LD VF, 03
+			0x8f, 0x07, // 202: SUBN VF, V0
+			0x3f, 0x01, // 204: SE VF, 01
+			0x61, 0x01, // 206: LD V1, 01
+		}},
+		{"if begin end", ": main if v0 == 1 begin v2 := 1 end", []byte{
+			0x30, 0x01, // 200: SE V0, 01
+			0x12, 0x06, // 202: JP 206
+			0x62, 0x01, // 204: LD V2, 01
+		}},
+		{"if begin else end", ": main if v0 != v1 begin v2 := 1 else v2 := 2 end", []byte{
+			0x90, 0x10, // 200: SNE V0, V1
+			0x12, 0x08, // 202: JP 208
+			0x62, 0x01, // 204: LD V2, 01
+			0x12, 0x0a, // 206: JP 20A
+			0x62, 0x02, // 208: LD V2, 02
+		}},
+		{"loop while again", ": main loop v0 += 1 while v0 != 10 again", []byte{
+			0x70, 0x01, // 200: ADD V0, 01
+			0x40, 0x0a, // 202: SNE V0, 0A
+			0x12, 0x08, // 204: JP 208
+			0x12, 0x00, // 206: JP 200
+		}},
+		{"nested loops", ": main loop loop v0 += 1 while v0 != 2 again v1 += 1 again", []byte{
+			0x70, 0x01, // 200: ADD V0, 01
+			0x40, 0x02, // 202: SNE V0, 02
+			0x12, 0x08, // 204: JP 208
+			0x12, 0x00, // 206: JP 200
+			0x71, 0x01, // 208: ADD V1, 01
+			0x12, 0x00, // 20A: JP 200
+		}},
+		{"labels before main", ": start :next operand : main v0 := 1 jump start", []byte{
+			0x60, 0x01, // 200: LD V0, 01
+			0x12, 0x00, // 202: JP 200
+		}},
+		{"next label before main", ": data :next operand : main i := operand", []byte{
+			0xa2, 0x01, // 200: LD I, 201
+		}},
+		{"label before main with code", ": start v1 := 2 : main jump start", []byte{
+			0x12, 0x04, // 200: JP 204
+			0x61, 0x02, // 202: LD V1, 02
+			0x12, 0x02, // 204: JP 202
+		}},
+		{"forward references", ": helper return : main helper jump finish : finish exit", []byte{
+			0x12, 0x04, // 200: JP 204
+			0x00, 0xee, // 202: RET
+			0x22, 0x02, // 204: CALL 202
+			0x12, 0x08, // 206: JP 208
+			0x00, 0xfd, // 208: EXIT
+		}},
+	}
+	for _, test := range tests {
+		program, err := Compile("test.8o", []byte(test.source))
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if !bytes.Equal(program.Code, test.code) {
+			t.Errorf("%s: Compile() = % x, expected % x", test.name, program.Code, test.code)
+		}
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		err    string
+	}{
+		{"forward reference out of range", ": main\n  jump far\n:org 0x1000\n: far exit", "test.8o:2: Address 1000 of label far is out of range"},
+		{"main out of range", ": data 1\n:org 0x1000\n: main exit", "test.8o:3: Label main at 1000 is out of range"},
+		{"address out of range", ": main jump 0x1000", "test.8o:1: Address 1000 is out of range"},
+		{"undefined label", ": main\njump nowhere", "test.8o:2: Undefined label nowhere"},
+		{"missing main", ": start exit", "test.8o: Missing label main"},
+		{"missing end", ": main if v0 == 1 begin", "test.8o: Missing again or end"},
+		{"else without begin", ": main else", "test.8o:1: Else without if ... begin"},
+		{"while outside loop", ": main while v0 == 1", "test.8o:1: While outside of loop"},
+	}
+	for _, test := range tests {
+		_, err := Compile("test.8o", []byte(test.source))
+		if err == nil {
+			t.Errorf("%s: Compile() succeeded, expected an error", test.name)
+			continue
+		}
+		if !strings.HasPrefix(err.Error(), test.err) {
+			t.Errorf("%s: Compile() error = %q, expected %q", test.name, err, test.err)
+		}
+	}
+}
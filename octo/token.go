@@ -0,0 +1,30 @@
+package octo
+
+import (
+	"bufio"
+	"bytes"
+	"strings"
+)
+
+// token represents a word of the source and where it was written
+type token struct {
+	text string
+	file string
+	line int
+}
+
+// tokenize splits the source into whitespace separated words, skipping # comments
+func tokenize(file string, source []byte) []token {
+	var tokens []token
+	scanner := bufio.NewScanner(bytes.NewReader(source))
+	for n := 1; scanner.Scan(); n++ {
+		line := scanner.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		for _, word := range strings.Fields(line) {
+			tokens = append(tokens, token{text: word, file: file, line: n})
+		}
+	}
+	return tokens
+}
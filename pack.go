@@ -0,0 +1,102 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/arjenvanderende/chip8/cartridge"
+	"github.com/arjenvanderende/chip8/chip8"
+	chipio "github.com/arjenvanderende/chip8/io"
+)
+
+// pack runs the cart subcommand, which packs a program and its settings into an Octo cartridge
+func pack(args []string) error {
+	flags := flag.NewFlagSet("cart", flag.ExitOnError)
+	output := flags.String("o", "", "The cartridge to write, defaults to the program with the .gif extension")
+	preset := flags.String("quirks", "default", fmt.Sprintf("The quirks preset of the program, one of %v", chip8.QuirksPresetNames()))
+	tickRate := flags.Int("tickrate", cartridge.DefaultOptions.TickRate, "The number of cycles per frame")
+	colors := flags.String("palette", "", fmt.Sprintf("The colors of the background, plane 1, plane 2 and both planes, e.g. #000000,#ffffff,#ff0000,#ffff00, or one of the themes %v", chipio.ThemeNames()))
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: chip8 cart [flags] program.ch8|program.8o\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return fmt.Errorf("Expected one program")
+	}
+
+	// cartridges contain Octo source, so ROM files are converted to data bytes
+	filename := flags.Arg(0)
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return fmt.Errorf("Unable to read program: %v", err)
+	}
+	cart := cartridge.Cartridge{Program: string(data), Options: cartridge.DefaultOptions}
+	if filepath.Ext(filename) != ".8o" {
+		cart.Program = romSource(data)
+	}
+
+	quirks, err := chip8.LookupQuirks(*preset)
+	if err != nil {
+		return err
+	}
+	cart.Options.SetQuirks(quirks)
+	cart.Options.TickRate = *tickRate
+	if *colors != "" {
+		palette, err := parsePalette(*colors)
+		if err != nil {
+			return err
+		}
+		cart.Options.SetPalette(palette)
+	}
+
+	gif := *output
+	if gif == "" {
+		gif = strings.TrimSuffix(filename, filepath.Ext(filename)) + ".gif"
+	}
+	f, err := os.Create(gif)
+	if err != nil {
+		return fmt.Errorf("Unable to create cartridge: %v", err)
+	}
+	defer f.Close()
+	return cartridge.Encode(f, &cart)
+}
+
+// romSource returns Octo source that compiles to the ROM
+func romSource(rom []byte) string {
+	var source strings.Builder
+	source.WriteString(": main\n")
+	for i, b := range rom {
+		fmt.Fprintf(&source, "0x%02X", b)
+		if i%16 == 15 || i == len(rom)-1 {
+			source.WriteString("\n")
+		} else {
+			source.WriteString(" ")
+		}
+	}
+	return source.String()
+}
+
+// parsePalette parses the comma-separated colors of the palette or the name of a theme
+func parsePalette(s string) (chipio.Palette, error) {
+	var palette chipio.Palette
+	if !strings.Contains(s, "#") {
+		return chipio.LookupTheme(s)
+	}
+	colors := strings.Split(s, ",")
+	if len(colors) != len(palette) {
+		return palette, fmt.Errorf("Expected %d colors in palette %s", len(palette), s)
+	}
+	for i, c := range colors {
+		var err error
+		if palette[i], err = chipio.ParseColor(strings.TrimSpace(c)); err != nil {
+			return palette, err
+		}
+	}
+	return palette, nil
+}
@@ -0,0 +1,101 @@
+// Package sourcemap relates the addresses of an assembled program to the lines of its source files
+package sourcemap
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+)
+
+// Line relates an address to a line in a source file
+type Line struct {
+	Addr int    `json:"addr"`
+	File string `json:"file"`
+	Line int    `json:"line"`
+}
+
+// Map relates addresses of a program to source lines and names
+type Map struct {
+	Lines   []Line         `json:"lines"`   // sorted by address
+	Symbols map[string]int `json:"symbols"` // addresses of the labels
+}
+
+// Load reads a source map from a JSON file. Relative file names of the source files are
+// resolved against the directory of the source map.
+func Load(filename string) (*Map, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to load source map %s: %v", filename, err)
+	}
+	var m Map
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("Unable to parse source map %s: %v", filename, err)
+	}
+	dir := filepath.Dir(filename)
+	for i, line := range m.Lines {
+		if !filepath.IsAbs(line.File) {
+			m.Lines[i].File = filepath.Join(dir, line.File)
+		}
+	}
+	sort.SliceStable(m.Lines, func(i, j int) bool { return m.Lines[i].Addr < m.Lines[j].Addr })
+	return &m, nil
+}
+
+// Save writes the source map as JSON to the file
+func (m *Map) Save(filename string) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(filename, data, 0644); err != nil {
+		return fmt.Errorf("Unable to save source map %s: %v", filename, err)
+	}
+	return nil
+}
+
+// Add relates the address to the line of the source file
+func (m *Map) Add(addr int, file string, line int) {
+	m.Lines = append(m.Lines, Line{Addr: addr, File: file, Line: line})
+}
+
+// Line returns the source line of the instruction at the address
+func (m *Map) Line(addr int) (Line, bool) {
+	for _, line := range m.Lines {
+		if line.Addr == addr {
+			return line, true
+		}
+	}
+	return Line{}, false
+}
+
+// Addr returns the address of the first instruction on the line of the source file
+func (m *Map) Addr(file string, line int) (int, bool) {
+	for _, l := range m.Lines {
+		if l.Line == line && sameFile(l.File, file) {
+			return l.Addr, true
+		}
+	}
+	return 0, false
+}
+
+// Symbol returns the name of the label at or before the address, like the function that contains it
+func (m *Map) Symbol(addr int) (string, bool) {
+	name, best := "", -1
+	for symbol, a := range m.Symbols {
+		if a <= addr && (a > best || a == best && symbol < name) {
+			name, best = symbol, a
+		}
+	}
+	return name, best >= 0
+}
+
+func sameFile(a, b string) bool {
+	if a == b {
+		return true
+	}
+	absA, errA := filepath.Abs(a)
+	absB, errB := filepath.Abs(b)
+	return errA == nil && errB == nil && absA == absB
+}